@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+)
+
+// requireAdmin checks the ApiKey authorization header against ADMIN_KEY.
+// The admin API is disabled when no key is configured. It writes the error
+// response itself.
+func (cfg *apiConfig) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if cfg.adminKey == "" {
+		respondWithError(w, http.StatusForbidden, "Admin API is disabled", nil)
+		return false
+	}
+	if !cfg.isAdmin(r) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid API key", nil)
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the request carries ADMIN_KEY, without writing
+// a response.
+func (cfg *apiConfig) isAdmin(r *http.Request) bool {
+	if cfg.adminKey == "" {
+		return false
+	}
+	apiKey, err := auth.GetAPIKey(r.Header)
+	return err == nil && subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) == 1
+}
+
+// adminOnly puts requireAdmin in front of a handler with no checks of its
+// own. Prometheus scrapes it with an "ApiKey" authorization type and
+// ADMIN_KEY as the credentials.
+func (cfg *apiConfig) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.requireAdmin(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
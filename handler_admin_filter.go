@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/filter"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
+)
+
+type FilterTerm struct {
+	Term   string `json:"term"`
+	Policy string `json:"policy"`
+}
+
+type ModerationFlag struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Terms     []string  `json:"terms"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerFilterTermsGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	terms := cfg.filter.Terms()
+	result := make([]FilterTerm, len(terms))
+	for i, t := range terms {
+		result[i] = FilterTerm{Term: t.Word, Policy: string(t.Policy)}
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerFilterTermsCreate(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := FilterTerm{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	term := filter.Normalize(params.Term)
+	if term == "" {
+		respondWithError(w, http.StatusBadRequest, "Term must contain letters or digits", nil)
+		return
+	}
+	policy, err := filter.ParsePolicy(params.Policy)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid policy", err)
+		return
+	}
+
+	saved, err := cfg.db.UpsertProfanityTerm(r.Context(), database.UpsertProfanityTermParams{
+		Term:   term,
+		Policy: string(policy),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save term", err)
+		return
+	}
+	cfg.filter.Set(saved.Term, policy)
+
+	respondWithJSON(w, http.StatusCreated, FilterTerm{Term: saved.Term, Policy: saved.Policy})
+}
+
+func (cfg *apiConfig) handlerFilterTermsDelete(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	term := filter.Normalize(r.PathValue("term"))
+	rows, err := cfg.db.DeleteProfanityTerm(r.Context(), term)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete term", err)
+		return
+	}
+	if !cfg.filter.Remove(term) && rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Term not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerModerationFlagsGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	flags, err := cfg.db.ListOpenModerationFlags(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get moderation queue", err)
+		return
+	}
+
+	result := make([]ModerationFlag, len(flags))
+	for i, f := range flags {
+		result[i] = ModerationFlag{
+			ID:        f.ID,
+			ChirpID:   f.ChirpID,
+			Terms:     f.Terms,
+			CreatedAt: f.CreatedAt,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func (cfg *apiConfig) handlerModerationFlagResolve(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	flagID, err := uuid.Parse(r.PathValue("flagID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid flag ID", err)
+		return
+	}
+
+	rows, err := cfg.db.ResolveModerationFlag(r.Context(), flagID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resolve flag", err)
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Flag not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flagForModeration queues a chirp for review. The chirp has already been
+// saved, so a failure here is logged rather than returned to the author.
+// With STORAGE=memory there is no queue and this does nothing.
+func (cfg *apiConfig) flagForModeration(ctx context.Context, chirpID uuid.UUID, terms []string) {
+	if cfg.db == nil {
+		return
+	}
+	_, err := cfg.db.CreateModerationFlag(ctx, database.CreateModerationFlagParams{
+		ChirpID: chirpID,
+		Terms:   terms,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't flag chirp for moderation", "chirp_id", chirpID, "error", err)
+	}
+}
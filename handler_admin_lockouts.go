@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type LoginLockout struct {
+	Scope          string    `json:"scope"`
+	Key            string    `json:"key"`
+	Failures       int32     `json:"failures"`
+	FirstFailureAt time.Time `json:"first_failure_at"`
+	LastFailureAt  time.Time `json:"last_failure_at"`
+	LockedUntil    time.Time `json:"locked_until"`
+}
+
+func (cfg *apiConfig) handlerLockoutsGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	rows, err := cfg.db.ListLoginLockouts(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get lockouts", err)
+		return
+	}
+
+	lockouts := make([]LoginLockout, len(rows))
+	for i, row := range rows {
+		lockouts[i] = LoginLockout{
+			Scope:          row.Scope,
+			Key:            row.Key,
+			Failures:       row.Failures,
+			FirstFailureAt: row.FirstFailureAt,
+			LastFailureAt:  row.LastFailureAt,
+			LockedUntil:    row.LockedUntil.Time,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, lockouts)
+}
+
+// handlerLockoutDelete clears a lockout along with its failure count, e.g.
+// DELETE /admin/lockouts/account/user@example.com or /admin/lockouts/ip/10.0.0.1.
+func (cfg *apiConfig) handlerLockoutDelete(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	scope := r.PathValue("scope")
+	key := r.PathValue("key")
+	switch scope {
+	case loginScopeAccount:
+		key = loginAccountKey(key)
+	case loginScopeIP:
+	default:
+		respondWithError(w, http.StatusBadRequest, "Scope must be account or ip", nil)
+		return
+	}
+
+	rows, err := cfg.db.ClearLoginFailures(r.Context(), database.ClearLoginFailuresParams{
+		Scope: scope,
+		Key:   key,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't clear lockout", err)
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Lockout not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
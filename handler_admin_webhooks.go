@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type WebhookEvent struct {
+	ID            uuid.UUID       `json:"id"`
+	Source        string          `json:"source"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Status        string          `json:"status"`
+	Attempts      int32           `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	ReceivedAt    time.Time       `json:"received_at"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+}
+
+func webhookEventFromDB(e database.WebhookInbox) WebhookEvent {
+	event := WebhookEvent{
+		ID:         e.ID,
+		Source:     e.Source,
+		EventID:    e.EventID,
+		EventType:  e.EventType,
+		Status:     e.Status,
+		Attempts:   e.Attempts,
+		LastError:  e.LastError.String,
+		ReceivedAt: e.ReceivedAt,
+	}
+	if e.Status == webhookPending || e.Status == webhookFailed {
+		event.NextAttemptAt = &e.NextAttemptAt
+	}
+	if e.ProcessedAt.Valid {
+		event.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return event
+}
+
+// handlerWebhookEventsGet lists inbox events, newest first, optionally
+// filtered with ?source= and ?status=, e.g. ?status=dead for the dead letters.
+func (cfg *apiConfig) handlerWebhookEventsGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	source := r.URL.Query().Get("source")
+	status := r.URL.Query().Get("status")
+	statuses := []string{webhookPending, webhookProcessing, webhookProcessed, webhookFailed, webhookDead}
+	if status != "" && !slices.Contains(statuses, status) {
+		respondWithError(w, http.StatusBadRequest, "Invalid status", nil)
+		return
+	}
+
+	sourceFilter := sql.NullString{String: source, Valid: source != ""}
+	statusFilter := sql.NullString{String: status, Valid: status != ""}
+	cursorReceivedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorReceivedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Newest first; paging backwards walks the other way
+	var rows []database.WebhookInbox
+	if page.backward() {
+		rows, err = cfg.db.ListWebhookEventsAsc(r.Context(), database.ListWebhookEventsAscParams{
+			Source:           sourceFilter,
+			Status:           statusFilter,
+			CursorReceivedAt: cursorReceivedAt,
+			CursorID:         cursorID,
+			RowLimit:         int32(page.Limit + 1),
+		})
+	} else {
+		rows, err = cfg.db.ListWebhookEventsDesc(r.Context(), database.ListWebhookEventsDescParams{
+			Source:           sourceFilter,
+			Status:           statusFilter,
+			CursorReceivedAt: cursorReceivedAt,
+			CursorID:         cursorID,
+			RowLimit:         int32(page.Limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook events", err)
+		return
+	}
+
+	rows, next, prev := paginate(rows, page, func(row database.WebhookInbox) pageCursor {
+		return pageCursor{CreatedAt: row.ReceivedAt, ID: row.ID}
+	})
+
+	events := make([]WebhookEvent, len(rows))
+	for i, row := range rows {
+		events[i] = webhookEventFromDB(row)
+	}
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, events)
+}
+
+// handlerWebhookEventGet returns one inbox event with its payload.
+func (cfg *apiConfig) handlerWebhookEventGet(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID", err)
+		return
+	}
+
+	row, err := cfg.db.GetWebhookEvent(r.Context(), eventID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Webhook event not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook event", err)
+		return
+	}
+
+	event := webhookEventFromDB(row)
+	event.Payload = row.Payload
+	respondWithJSON(w, http.StatusOK, event)
+}
+
+// handlerWebhookEventReplay queues an event to be processed again from
+// scratch, whatever its status, unless a worker is processing it right now.
+func (cfg *apiConfig) handlerWebhookEventReplay(w http.ResponseWriter, r *http.Request) {
+	if !cfg.requireAdmin(w, r) {
+		return
+	}
+
+	eventID, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID", err)
+		return
+	}
+
+	row, err := cfg.db.ReplayWebhookEvent(r.Context(), eventID)
+	if err == sql.ErrNoRows {
+		// Either it doesn't exist or it is being processed
+		_, err = cfg.db.GetWebhookEvent(r.Context(), eventID)
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Webhook event not found", nil)
+			return
+		}
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "Webhook event is being processed", nil)
+			return
+		}
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't replay webhook event", err)
+		return
+	}
+
+	cfg.webhooks.notify()
+	respondWithJSON(w, http.StatusAccepted, webhookEventFromDB(row))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type ChirpSearchResult struct {
+	Chirp
+	Rank float32 `json:"rank"`
+	// Snippet is HTML: the body is escaped and matches are wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+func (cfg *apiConfig) handlerChirpsSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query", nil)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	author := uuid.NullUUID{}
+	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author_id", err)
+			return
+		}
+		author = uuid.NullUUID{UUID: authorUUID, Valid: true}
+	}
+
+	since, err := parseTimeParam(r, "since")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid since", err)
+		return
+	}
+	until, err := parseTimeParam(r, "until")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid until", err)
+		return
+	}
+
+	cursorRank := sql.NullFloat64{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorRank = sql.NullFloat64{Float64: page.Cursor.Rank, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Results are ordered by relevance; paging backwards walks the ranking
+	// in the opposite direction
+	var rows []database.SearchChirpsDescRow
+	if page.backward() {
+		ascRows, err := cfg.db.SearchChirpsAsc(r.Context(), database.SearchChirpsAscParams{
+			Query:      query,
+			AuthorID:   author,
+			Since:      since,
+			Until:      until,
+			CursorRank: cursorRank,
+			CursorID:   cursorID,
+			RowLimit:   int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps", err)
+			return
+		}
+		for _, row := range ascRows {
+			rows = append(rows, database.SearchChirpsDescRow(row))
+		}
+	} else {
+		rows, err = cfg.db.SearchChirpsDesc(r.Context(), database.SearchChirpsDescParams{
+			Query:      query,
+			AuthorID:   author,
+			Since:      since,
+			Until:      until,
+			CursorRank: cursorRank,
+			CursorID:   cursorID,
+			RowLimit:   int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps", err)
+			return
+		}
+	}
+
+	rows, next, prev := paginate(rows, page, func(row database.SearchChirpsDescRow) pageCursor {
+		return pageCursor{CreatedAt: row.CreatedAt, ID: row.ID, Rank: float64(row.Rank)}
+	})
+
+	chirps := make([]database.Chirp, len(rows))
+	for i, row := range rows {
+		chirps[i] = database.Chirp{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+			Body:       row.Body,
+			UserID:     row.UserID,
+			InReplyTo:  row.InReplyTo,
+			ReplyCount: row.ReplyCount,
+			LikeCount:  row.LikeCount,
+		}
+	}
+	converted, err := cfg.chirpsForViewer(r, chirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps", err)
+		return
+	}
+
+	result := make([]ChirpSearchResult, len(rows))
+	for i, row := range rows {
+		result[i] = ChirpSearchResult{
+			Chirp:   converted[i],
+			Rank:    row.Rank,
+			Snippet: row.Snippet,
+		}
+	}
+
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func parseTimeParam(r *http.Request, name string) (sql.NullTime, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
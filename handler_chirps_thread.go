@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type ChirpThread struct {
+	Ancestors []Chirp `json:"ancestors"`
+	Chirp     Chirp   `json:"chirp"`
+	Replies   []Chirp `json:"replies"`
+}
+
+func (cfg *apiConfig) handlerChirpThreadGet(w http.ResponseWriter, r *http.Request) {
+	chirpUUID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	chirp, err := cfg.store.GetChirpByID(r.Context(), chirpUUID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	ancestors, err := cfg.store.GetChirpAncestors(r.Context(), chirpUUID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread", err)
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Replies are shown oldest first; paging backwards walks the other way
+	var replies []database.Chirp
+	if page.backward() {
+		replies, err = cfg.store.GetChirpDescendantsDesc(r.Context(), database.GetChirpDescendantsDescParams{
+			ChirpID:         chirpUUID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	} else {
+		replies, err = cfg.store.GetChirpDescendantsAsc(r.Context(), database.GetChirpDescendantsAscParams{
+			ChirpID:         chirpUUID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread", err)
+		return
+	}
+
+	replies, next, prev := paginate(replies, page, func(c database.Chirp) pageCursor {
+		return pageCursor{CreatedAt: c.CreatedAt, ID: c.ID}
+	})
+
+	// Look up likes for the whole thread in one go
+	all := append(append(ancestors, chirp), replies...)
+	converted, err := cfg.chirpsForViewer(r, all)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thread", err)
+		return
+	}
+
+	thread := ChirpThread{
+		Ancestors: converted[:len(ancestors)],
+		Chirp:     converted[len(ancestors)],
+		Replies:   converted[len(ancestors)+1:],
+	}
+
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, thread)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func (cfg *apiConfig) handlerChirpUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return
+	}
+
+	userID, err := cfg.keys.ValidateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return
+	}
+	if !cfg.requireVerified(w, r, userID, actionChirp) {
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		return
+	}
+
+	if len(params.Body) > cfg.maxChirpLength {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
+		return
+	}
+
+	chirp, err := cfg.store.GetChirpByID(r.Context(), chirpUUID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	if chirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this chirp", nil)
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	editWindow := cfg.chirpEditWindow
+	if user.IsChirpyRed {
+		editWindow = cfg.chirpEditWindowRed
+	}
+	if time.Since(chirp.CreatedAt) > editWindow {
+		respondWithError(w, http.StatusForbidden, "Edit window has expired", nil)
+		return
+	}
+
+	filtered := cfg.filter.Check(params.Body)
+	if filtered.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains banned words", nil)
+		return
+	}
+
+	updated, err := cfg.store.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   chirpUUID,
+		Body: filtered.Body,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp", err)
+		return
+	}
+
+	if filtered.Moderate {
+		cfg.flagForModeration(r.Context(), updated.ID, filtered.Matches)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpFromDB(updated))
+}
+
+func (cfg *apiConfig) handlerChirpRevisionsGet(w http.ResponseWriter, r *http.Request) {
+	chirpUUID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+
+	_, err = cfg.store.GetChirpByID(r.Context(), chirpUUID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	revisions, err := cfg.store.GetChirpRevisions(r.Context(), chirpUUID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get revisions", err)
+		return
+	}
+
+	result := make([]ChirpRevision, len(revisions))
+	for i, rev := range revisions {
+		result[i] = ChirpRevision{
+			ID:         rev.ID,
+			ChirpID:    rev.ChirpID,
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
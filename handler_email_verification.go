@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/mail"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/storage"
+)
+
+const emailVerificationDuration = 24 * time.Hour
+
+// What accounts with an unverified email may do, set with UNVERIFIED_POLICY
+// (see config.Config).
+const (
+	unverifiedAllow    = "allow"
+	unverifiedNoChirps = "no_chirps"
+	unverifiedReadOnly = "read_only"
+)
+
+// Actions the unverified policy can restrict.
+const (
+	actionChirp  = "chirp"
+	actionSocial = "social"
+)
+
+// requireVerified stops users who haven't verified their email from doing
+// what the unverified policy forbids. It writes the error response itself.
+func (cfg *apiConfig) requireVerified(w http.ResponseWriter, r *http.Request, userID uuid.UUID, action string) bool {
+	switch {
+	case cfg.unverifiedPolicy == unverifiedAllow:
+		return true
+	case cfg.unverifiedPolicy == unverifiedNoChirps && action != actionChirp:
+		return true
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address first", nil)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerEmailVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+	type response struct {
+		User
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	token, err := cfg.store.UseEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check verification token", err)
+		return
+	}
+
+	// Fails if the user has since asked to change to another address
+	user, err := cfg.store.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		Email: token.Email,
+		ID:    token.UserID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token", nil)
+		return
+	}
+	if errors.Is(err, storage.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email is already in use", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		User: userFromDB(user),
+	})
+}
+
+// handlerEmailVerifyResend sends a new link for the pending address, or for
+// the current one if it hasn't been verified yet.
+func (cfg *apiConfig) handlerEmailVerifyResend(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	cfg.background.Go(func() { cfg.sendEmailVerification(user.ID, email) })
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendEmailVerification(userID uuid.UUID, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.Error("Couldn't create email verification token", "error", err)
+		return
+	}
+	err = cfg.store.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationDuration),
+	})
+	if err != nil {
+		slog.Error("Couldn't save email verification token", "user_id", userID, "error", err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email for Chirpy",
+		Body: fmt.Sprintf("Confirm this address for your Chirpy account with the token:\n\n%s\n\n"+
+			"It expires in %s. If you didn't sign up for Chirpy, you can ignore this email.\n",
+			token, emailVerificationDuration),
+	})
+	if err != nil {
+		slog.Error("Couldn't send email verification", "user_id", userID, "error", err)
+	}
+}
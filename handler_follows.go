@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) handlerFollowCreate(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.followRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.requireVerified(w, r, followerID, actionSocial) {
+		return
+	}
+
+	if followerID == followeeID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself", nil)
+		return
+	}
+
+	_, err := cfg.store.GetUserByID(r.Context(), followeeID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+
+	rows, err := cfg.db.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user", err)
+		return
+	}
+	if rows > 0 {
+		// Both sides hear about it
+		cfg.outbound.emit(r.Context(), eventFollowCreated, struct {
+			FollowerID uuid.UUID `json:"follower_id"`
+			FolloweeID uuid.UUID `json:"followee_id"`
+		}{followerID, followeeID}, followerID, followeeID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerFollowDelete(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.followRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// followRequest authenticates the caller and parses the user being
+// (un)followed from the path. It writes the error response itself.
+func (cfg *apiConfig) followRequest(w http.ResponseWriter, r *http.Request) (followerID, followeeID uuid.UUID, ok bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	followerID, err = cfg.keys.ValidateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	followeeID, err = uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return followerID, followeeID, true
+}
+
+func (cfg *apiConfig) handlerFollowersGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, true)
+}
+
+func (cfg *apiConfig) handlerFollowingGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listFollows(w, r, false)
+}
+
+// listFollows serves both directions of the follow graph, newest first.
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	var follows []Follow
+	switch {
+	case followers && page.backward():
+		rows, err := cfg.db.ListFollowersAsc(r.Context(), database.ListFollowersAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get followers", err)
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	case followers:
+		rows, err := cfg.db.ListFollowersDesc(r.Context(), database.ListFollowersDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get followers", err)
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	case page.backward():
+		rows, err := cfg.db.ListFollowingAsc(r.Context(), database.ListFollowingAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get following", err)
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	default:
+		rows, err := cfg.db.ListFollowingDesc(r.Context(), database.ListFollowingDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get following", err)
+			return
+		}
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.UserID, FollowedAt: row.CreatedAt})
+		}
+	}
+
+	follows, next, prev := paginate(follows, page, func(f Follow) pageCursor {
+		return pageCursor{CreatedAt: f.FollowedAt, ID: f.UserID}
+	})
+	if follows == nil {
+		follows = []Follow{}
+	}
+
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, follows)
+}
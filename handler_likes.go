@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+func (cfg *apiConfig) handlerChirpLike(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.requireVerified(w, r, userID, actionSocial) {
+		return
+	}
+
+	err := cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't like chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerChirpUnlike(w http.ResponseWriter, r *http.Request) {
+	userID, chirpID, ok := cfg.likeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlike chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// likeRequest authenticates the caller and checks the chirp in the path
+// exists. It writes the error response itself.
+func (cfg *apiConfig) likeRequest(w http.ResponseWriter, r *http.Request) (userID, chirpID uuid.UUID, ok bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, err = cfg.keys.ValidateJWT(token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chirpID, err = uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chirp, err := cfg.store.GetChirpByID(r.Context(), chirpID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, chirpID, true
+}
+
+func (cfg *apiConfig) handlerUserLikesGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Most recently liked first; paging backwards walks the other way
+	var rows []database.ListLikedChirpsDescRow
+	if page.backward() {
+		ascRows, err := cfg.db.ListLikedChirpsAsc(r.Context(), database.ListLikedChirpsAscParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get likes", err)
+			return
+		}
+		for _, row := range ascRows {
+			rows = append(rows, database.ListLikedChirpsDescRow(row))
+		}
+	} else {
+		rows, err = cfg.db.ListLikedChirpsDesc(r.Context(), database.ListLikedChirpsDescParams{
+			UserID:          userID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get likes", err)
+			return
+		}
+	}
+
+	rows, next, prev := paginate(rows, page, func(row database.ListLikedChirpsDescRow) pageCursor {
+		return pageCursor{CreatedAt: row.LikedAt, ID: row.Chirp.ID}
+	})
+
+	chirps := make([]database.Chirp, len(rows))
+	for i, row := range rows {
+		chirps[i] = row.Chirp
+	}
+	result, err := cfg.chirpsForViewer(r, chirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get likes", err)
+		return
+	}
+
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// viewerID returns the authenticated caller on endpoints where
+// authentication is optional. A missing or invalid token means anonymous.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	userID, err := cfg.keys.ValidateJWT(token)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// chirpsForViewer converts chirps to the response format, flagging the
+// ones the caller has liked with a single lookup. Likes need Postgres, so
+// with STORAGE=memory nothing is flagged.
+func (cfg *apiConfig) chirpsForViewer(r *http.Request, chirps []database.Chirp) ([]Chirp, error) {
+	result := make([]Chirp, len(chirps))
+	for i, c := range chirps {
+		result[i] = chirpFromDB(c)
+	}
+
+	viewer := cfg.viewerID(r)
+	if !viewer.Valid || len(chirps) == 0 || cfg.db == nil {
+		return result, nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+	liked, err := cfg.db.GetLikedChirpIDs(r.Context(), database.GetLikedChirpIDsParams{
+		UserID:   viewer.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	likedSet := make(map[uuid.UUID]struct{}, len(liked))
+	for _, id := range liked {
+		likedSet[id] = struct{}{}
+	}
+	for i := range result {
+		_, result[i].LikedByMe = likedSet[result[i].ID]
+	}
+	return result, nil
+}
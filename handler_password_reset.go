@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/mail"
+)
+
+const (
+	passwordResetDuration = time.Hour
+	mailTimeout           = 30 * time.Second
+)
+
+// handlerPasswordForgot always answers 202 and does the work in the
+// background, so neither the response nor its timing reveals whether the
+// email belongs to an account.
+func (cfg *apiConfig) handlerPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+	email, err := mail.NormalizeAddress(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", nil)
+		return
+	}
+
+	cfg.background.Go(func() { cfg.sendPasswordReset(email) })
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	user, err := cfg.store.GetUserByEmail(ctx, email)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't look up user for password reset", "error", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.Error("Couldn't create password reset token", "error", err)
+		return
+	}
+	err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetDuration),
+	})
+	if err != nil {
+		slog.Error("Couldn't save password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Your reset token is:\n\n%s\n\n"+
+			"It expires in %s and can only be used once. If you didn't ask for this, you can ignore this email.\n",
+			token, passwordResetDuration),
+	})
+	if err != nil {
+		slog.Error("Couldn't send password reset email", "user_id", user.ID, "error", err)
+	}
+}
+
+// handlerPasswordReset sets a new password with a token from
+// handlerPasswordForgot and signs the user out everywhere.
+func (cfg *apiConfig) handlerPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required", nil)
+		return
+	}
+
+	userID, err := cfg.db.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check reset token", err)
+		return
+	}
+
+	hashPass, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		return
+	}
+	err = cfg.store.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashPass,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password", err)
+		return
+	}
+
+	err = cfg.store.RevokeUserSessions(r.Context(), database.RevokeUserSessionsParams{
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	err = cfg.db.DeletePasswordResetTokens(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete reset tokens", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+const (
+	subscriptionActive   = "active"
+	subscriptionPastDue  = "past_due"
+	subscriptionCanceled = "canceled"
+	subscriptionExpired  = "expired"
+	subscriptionRefunded = "refunded"
+
+	defaultSubscriptionPlan   = "red"
+	subscriptionExpiryPeriod  = 5 * time.Minute
+	subscriptionHistoryLength = 20
+)
+
+// Polka events that change a subscription.
+const (
+	polkaUserUpgraded   = "user.upgraded"
+	polkaUserDowngraded = "user.downgraded"
+	polkaRenewed        = "subscription.renewed"
+	polkaPaymentFailed  = "subscription.payment_failed"
+	polkaRefunded       = "subscription.refunded"
+)
+
+type Subscription struct {
+	Status      string              `json:"status"`
+	Plan        string              `json:"plan,omitempty"`
+	PeriodEnd   *time.Time          `json:"period_end,omitempty"`
+	IsChirpyRed bool                `json:"is_chirpy_red"`
+	History     []SubscriptionEvent `json:"history"`
+}
+
+type SubscriptionEvent struct {
+	Event      string    `json:"event"`
+	Status     string    `json:"status,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// subscriptionChange works out how a Polka event changes a subscription.
+// ApplySubscription merges it with the current row: Plan and PeriodEnd
+// replace the stored values when set, PeriodEndDefault fills in a missing
+// period end, and NewPeriodEnd is used when the user has never subscribed.
+// ReplacePeriodEnd overwrites the stored period end with PeriodEnd even when
+// it is NULL, so a new subscription never inherits one that already ended.
+// ok is false for events that don't concern subscriptions.
+//
+// Downgrades and failed payments keep Chirpy Red until the paid period
+// ends, when expireSubscriptions takes it away. Refunds take it away now.
+func subscriptionChange(event polkaEvent, receivedAt, now time.Time) (database.ApplySubscriptionParams, bool) {
+	change := database.ApplySubscriptionParams{
+		UserID:      event.Data.UserID,
+		Plan:        sql.NullString{String: event.Data.Plan, Valid: event.Data.Plan != ""},
+		DefaultPlan: defaultSubscriptionPlan,
+		EventAt:     receivedAt,
+	}
+	periodEnd := sql.NullTime{}
+	if event.Data.PeriodEnd != nil {
+		periodEnd = sql.NullTime{Time: *event.Data.PeriodEnd, Valid: true}
+	}
+	nowTime := sql.NullTime{Time: now, Valid: true}
+
+	switch event.Event {
+	case polkaUserUpgraded, polkaRenewed:
+		change.Status = subscriptionActive
+		change.ReplacePeriodEnd = true
+		change.PeriodEnd = periodEnd
+		change.NewPeriodEnd = periodEnd
+	case polkaPaymentFailed:
+		change.Status = subscriptionPastDue
+		change.PeriodEnd = periodEnd
+		change.NewPeriodEnd = nowTime
+	case polkaUserDowngraded:
+		change.Status = subscriptionCanceled
+		change.PeriodEnd = periodEnd
+		change.PeriodEndDefault = nowTime
+		change.NewPeriodEnd = periodEnd
+		if !periodEnd.Valid {
+			change.NewPeriodEnd = nowTime
+		}
+	case polkaRefunded:
+		change.Status = subscriptionRefunded
+		change.ReplacePeriodEnd = true
+		change.PeriodEnd = nowTime
+		change.NewPeriodEnd = nowTime
+	default:
+		return database.ApplySubscriptionParams{}, false
+	}
+	return change, true
+}
+
+// applyPolkaEvent updates the user's subscription and records the event in
+// its history. receivedAt orders the events: one received before the last
+// event applied is recorded but doesn't change the subscription.
+func (cfg *apiConfig) applyPolkaEvent(ctx context.Context, event polkaEvent, receivedAt time.Time, payload []byte) error {
+	userID := uuid.NullUUID{UUID: event.Data.UserID, Valid: event.Data.UserID != uuid.Nil}
+
+	change, ok := subscriptionChange(event, receivedAt, time.Now())
+	if !ok {
+		// Kept for the record, but there is nothing to do
+		err := cfg.db.RecordSubscriptionEvent(ctx, database.RecordSubscriptionEventParams{
+			UserID:  userID,
+			Event:   event.Event,
+			Payload: payload,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't record event: %w", err)
+		}
+		cfg.metrics.webhookEvents.With(webhookSourcePolka, "other", "ignored").Inc()
+		return nil
+	}
+
+	_, err := cfg.store.GetUserByID(ctx, event.Data.UserID)
+	if err == sql.ErrNoRows {
+		cfg.metrics.webhookEvents.With(webhookSourcePolka, event.Event, "unknown_user").Inc()
+		return permanentError{fmt.Errorf("user %s not found", event.Data.UserID)}
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get user: %w", err)
+	}
+
+	next, err := cfg.db.ApplySubscription(ctx, change)
+	if err == sql.ErrNoRows {
+		// A newer event got there first
+		err := cfg.db.RecordSubscriptionEvent(ctx, database.RecordSubscriptionEventParams{
+			UserID:  userID,
+			Event:   event.Event,
+			Payload: payload,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't record event: %w", err)
+		}
+		cfg.metrics.webhookEvents.With(webhookSourcePolka, event.Event, "stale").Inc()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't update subscription: %w", err)
+	}
+	err = cfg.db.RecordSubscriptionEvent(ctx, database.RecordSubscriptionEventParams{
+		UserID:  userID,
+		Event:   event.Event,
+		Status:  sql.NullString{String: next.Status, Valid: true},
+		Payload: payload,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't record event: %w", err)
+	}
+
+	if next.IsChirpyRed && !next.WasChirpyRed {
+		upgraded := struct {
+			UserID    uuid.UUID  `json:"user_id"`
+			Plan      string     `json:"plan"`
+			PeriodEnd *time.Time `json:"period_end,omitempty"`
+		}{UserID: next.UserID, Plan: next.Plan}
+		if next.PeriodEnd.Valid {
+			upgraded.PeriodEnd = &next.PeriodEnd.Time
+		}
+		cfg.outbound.emit(ctx, eventUserUpgraded, upgraded, next.UserID)
+	}
+
+	cfg.metrics.webhookEvents.With(webhookSourcePolka, event.Event, "processed").Inc()
+	return nil
+}
+
+func (cfg *apiConfig) handlerSubscriptionGet(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		return
+	}
+	resp := Subscription{
+		Status:      "none",
+		IsChirpyRed: user.IsChirpyRed,
+		History:     []SubscriptionEvent{},
+	}
+
+	sub, err := cfg.db.GetSubscription(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+	if err == nil {
+		resp.Status = sub.Status
+		resp.Plan = sub.Plan
+		if sub.PeriodEnd.Valid {
+			resp.PeriodEnd = &sub.PeriodEnd.Time
+		}
+	}
+
+	events, err := cfg.db.ListSubscriptionEvents(r.Context(), database.ListSubscriptionEventsParams{
+		UserID: uuid.NullUUID{UUID: userID, Valid: true},
+		Limit:  subscriptionHistoryLength,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription history", err)
+		return
+	}
+	for _, e := range events {
+		resp.History = append(resp.History, SubscriptionEvent{
+			Event:      e.Event,
+			Status:     e.Status.String,
+			ReceivedAt: e.ReceivedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// expireSubscriptions takes Chirpy Red away from users whose paid period
+// has ended, until ctx is done.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) {
+	ticker := time.NewTicker(subscriptionExpiryPeriod)
+	defer ticker.Stop()
+	for {
+		expired, err := cfg.db.ExpireSubscriptions(ctx)
+		if err != nil {
+			slog.Error("Couldn't expire subscriptions", "error", err)
+		} else if len(expired) > 0 {
+			slog.Info("Expired subscriptions", "count", len(expired))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+func polkaTestEvent(event string, userID uuid.UUID, periodEnd *time.Time) polkaEvent {
+	e := polkaEvent{Event: event}
+	e.Data.UserID = userID
+	e.Data.PeriodEnd = periodEnd
+	return e
+}
+
+func TestSubscriptionChange(t *testing.T) {
+	userID := uuid.New()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(30 * 24 * time.Hour)
+	nowTime := sql.NullTime{Time: now, Valid: true}
+	laterTime := sql.NullTime{Time: later, Valid: true}
+
+	tests := []struct {
+		name      string
+		event     polkaEvent
+		ok        bool
+		status    string
+		replace   bool
+		periodEnd sql.NullTime
+		dflt      sql.NullTime
+		newEnd    sql.NullTime
+	}{
+		{"upgrade with period end", polkaTestEvent(polkaUserUpgraded, userID, &later), true, subscriptionActive, true, laterTime, sql.NullTime{}, laterTime},
+		{"upgrade without period end", polkaTestEvent(polkaUserUpgraded, userID, nil), true, subscriptionActive, true, sql.NullTime{}, sql.NullTime{}, sql.NullTime{}},
+		{"renewal without period end", polkaTestEvent(polkaRenewed, userID, nil), true, subscriptionActive, true, sql.NullTime{}, sql.NullTime{}, sql.NullTime{}},
+		{"failed payment", polkaTestEvent(polkaPaymentFailed, userID, nil), true, subscriptionPastDue, false, sql.NullTime{}, sql.NullTime{}, nowTime},
+		{"downgrade with period end", polkaTestEvent(polkaUserDowngraded, userID, &later), true, subscriptionCanceled, false, laterTime, nowTime, laterTime},
+		{"downgrade without period end", polkaTestEvent(polkaUserDowngraded, userID, nil), true, subscriptionCanceled, false, sql.NullTime{}, nowTime, nowTime},
+		{"refund", polkaTestEvent(polkaRefunded, userID, &later), true, subscriptionRefunded, true, nowTime, sql.NullTime{}, nowTime},
+		{"other event", polkaTestEvent("user.created", userID, nil), false, "", false, sql.NullTime{}, sql.NullTime{}, sql.NullTime{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, ok := subscriptionChange(tt.event, now, now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if change.UserID != userID || change.EventAt != now {
+				t.Errorf("user %v at %v, want %v at %v", change.UserID, change.EventAt, userID, now)
+			}
+			if change.Status != tt.status {
+				t.Errorf("Status = %q, want %q", change.Status, tt.status)
+			}
+			if change.ReplacePeriodEnd != tt.replace {
+				t.Errorf("ReplacePeriodEnd = %v, want %v", change.ReplacePeriodEnd, tt.replace)
+			}
+			if change.PeriodEnd != tt.periodEnd {
+				t.Errorf("PeriodEnd = %v, want %v", change.PeriodEnd, tt.periodEnd)
+			}
+			if change.PeriodEndDefault != tt.dflt {
+				t.Errorf("PeriodEndDefault = %v, want %v", change.PeriodEndDefault, tt.dflt)
+			}
+			if change.NewPeriodEnd != tt.newEnd {
+				t.Errorf("NewPeriodEnd = %v, want %v", change.NewPeriodEnd, tt.newEnd)
+			}
+		})
+	}
+}
+
+// TestApplySubscription checks how ApplySubscription merges events with the
+// stored subscription. It needs a migrated database it may wipe, e.g.
+// STORAGE_TEST_DB_URL=postgres://localhost/chirpy_test?sslmode=disable.
+func TestApplySubscription(t *testing.T) {
+	url := os.Getenv("STORAGE_TEST_DB_URL")
+	if url == "" {
+		t.Skip("STORAGE_TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	queries := database.New(db)
+	ctx := context.Background()
+	if err := queries.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	future := time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond)
+
+	type step struct {
+		event     string
+		periodEnd *time.Time
+		expire    bool
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		red       bool
+		periodEnd *time.Time
+	}{
+		{
+			name:  "refund then upgrade",
+			steps: []step{{event: polkaUserUpgraded, periodEnd: &future}, {event: polkaRefunded}, {event: polkaUserUpgraded}},
+			red:   true,
+		},
+		{
+			name:  "expired then upgrade",
+			steps: []step{{event: polkaUserUpgraded, periodEnd: &past, expire: true}, {event: polkaUserUpgraded}},
+			red:   true,
+		},
+		{
+			name:      "expired then upgrade with period end",
+			steps:     []step{{event: polkaUserUpgraded, periodEnd: &past, expire: true}, {event: polkaRenewed, periodEnd: &future}},
+			red:       true,
+			periodEnd: &future,
+		},
+		{
+			name:  "legacy row without period end",
+			steps: []step{{event: polkaUserUpgraded}, {event: polkaRenewed}},
+			red:   true,
+		},
+		{
+			name:  "legacy row downgraded",
+			steps: []step{{event: polkaUserUpgraded}, {event: polkaUserDowngraded}},
+			red:   false,
+		},
+		{
+			name:      "failed payment keeps the period end",
+			steps:     []step{{event: polkaUserUpgraded, periodEnd: &future}, {event: polkaPaymentFailed}},
+			red:       true,
+			periodEnd: &future,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := queries.CreateUser(ctx, database.CreateUserParams{
+				Email:          uuid.NewString() + "@example.com",
+				HashedPassword: "hash",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sub database.ApplySubscriptionRow
+			for i, s := range tt.steps {
+				change, _ := subscriptionChange(polkaTestEvent(s.event, user.ID, s.periodEnd), time.Now(), time.Now())
+				sub, err = queries.ApplySubscription(ctx, change)
+				if err != nil {
+					t.Fatalf("step %d (%s): %v", i, s.event, err)
+				}
+				if s.expire {
+					if _, err := queries.ExpireSubscriptions(ctx); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if sub.IsChirpyRed != tt.red {
+				t.Errorf("IsChirpyRed = %v, want %v", sub.IsChirpyRed, tt.red)
+			}
+			if tt.periodEnd != nil && (!sub.PeriodEnd.Valid || !sub.PeriodEnd.Time.Equal(*tt.periodEnd)) {
+				t.Errorf("PeriodEnd = %v, want %v", sub.PeriodEnd, *tt.periodEnd)
+			}
+			got, err := queries.GetUserByID(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IsChirpyRed != tt.red {
+				t.Errorf("user IsChirpyRed = %v, want %v", got.IsChirpyRed, tt.red)
+			}
+		})
+	}
+}
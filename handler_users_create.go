@@ -3,12 +3,17 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
 	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/mail"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/storage"
 )
 
 type User struct {
@@ -19,6 +24,20 @@ type User struct {
 	Token         string    `json:"token"`
 	Refresh_token string    `json:"refresh_token"`
 	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+}
+
+func userFromDB(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+	}
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -37,36 +56,39 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
+	email, err := mail.NormalizeAddress(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
 	hashPass, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
 		return
 	}
 
-	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hashPass})
+	user, err := cfg.store.CreateUser(r.Context(), database.CreateUserParams{Email: email, HashedPassword: hashPass})
+	if errors.Is(err, storage.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email is already in use", nil)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
 		return
 	}
 
+	cfg.background.Go(func() { cfg.sendEmailVerification(user.ID, user.Email) })
+
 	respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User: userFromDB(user),
 	})
 }
 
 func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
-	}
-	type response struct {
-		User
+		Password   string `json:"password"`
+		Email      string `json:"email"`
+		DeviceName string `json:"device_name"`
 	}
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
@@ -76,20 +98,54 @@ func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.db.GetUserByEmail(r.Context(), params.Email)
+	if !cfg.loginGuard.allow(w, r, params.Email) {
+		return
+	}
+
+	// An address that doesn't parse can't belong to anyone
+	email, err := mail.NormalizeAddress(params.Email)
+	var user database.User
+	if err == nil {
+		user, err = cfg.store.GetUserByEmail(r.Context(), email)
+	}
 	if err != nil {
+		cfg.loginGuard.recordFailure(r, params.Email)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
 		return
 	}
 
 	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil || !match {
+		cfg.loginGuard.recordFailure(r, params.Email)
 		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
 		return
 	}
 
-	expiresIn := time.Hour
-	createJWT, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Duration(expiresIn))
+	if user.TotpEnabled {
+		mfaToken, err := cfg.keys.MakeMFAChallenge(user.ID, mfaChallengeDuration)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create MFA challenge", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, MFAChallenge{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	// Failures are only forgotten once the whole login succeeds, so
+	// guessing second factors counts against the account too
+	cfg.loginGuard.recordSuccess(r.Context(), user.Email)
+	cfg.startSession(w, r, user, params.DeviceName)
+}
+
+// startSession issues the access and refresh tokens for a fully
+// authenticated login.
+func (cfg *apiConfig) startSession(w http.ResponseWriter, r *http.Request, user database.User, deviceName string) {
+	type response struct {
+		User
+	}
+
+	familyID := uuid.New()
+	createJWT, err := cfg.keys.MakeSessionJWT(user.ID, familyID, cfg.accessTokenDuration)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't create jwt", nil)
 		return
@@ -100,29 +156,32 @@ func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusUnauthorized, "Couldn't create refresh token", nil)
 		return
 	}
-	refreshExpiresAt := time.Now().Add(60 * 24 * time.Hour) // 60 дней
-	createRefreshToken, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: refreshExpiresAt,
+	label := deviceName
+	if label == "" {
+		label = deviceLabel(r.UserAgent())
+	}
+	refreshExpiresAt := time.Now().Add(cfg.refreshTokenDuration)
+	createRefreshToken, err := cfg.store.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:       refreshToken,
+		UserID:      user.ID,
+		ExpiresAt:   refreshExpiresAt,
+		FamilyID:    familyID,
+		UserAgent:   r.UserAgent(),
+		IpAddress:   clientip.FromRequest(r),
+		DeviceLabel: label,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't create refresh token", nil)
 		return
 	}
 
+	cfg.metrics.logins.With("success").Inc()
+	resp := userFromDB(user)
+	resp.Token = createJWT
+	resp.Refresh_token = createRefreshToken.Token
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:            user.ID,
-			CreatedAt:     user.CreatedAt,
-			UpdatedAt:     user.UpdatedAt,
-			Email:         user.Email,
-			Token:         createJWT,
-			Refresh_token: createRefreshToken.Token,
-			IsChirpyRed:   user.IsChirpyRed,
-		},
+		User: resp,
 	})
-
 }
 
 func (cfg *apiConfig) handlerRefreshCreate(w http.ResponseWriter, r *http.Request) {
@@ -133,34 +192,70 @@ func (cfg *apiConfig) handlerRefreshCreate(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	// 2. Find in DB
-	refreshToken, err := cfg.db.GetUserFromRefreshToken(r.Context(), token)
+	refreshToken, err := cfg.store.GetUserFromRefreshToken(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid token", nil)
 		return
 	}
-	// 3. Check expires_at
+	// 3. Check revoked_at
+	// A token that was already rotated is being replayed: assume it was
+	// stolen and kill every token descended from the same login
+	if refreshToken.RevokedAt.Valid {
+		if refreshToken.ReplacedBy.Valid {
+			cfg.revokeRefreshTokenFamily(r, refreshToken)
+		}
+		respondWithError(w, http.StatusUnauthorized, "Token has been revoked", nil)
+		return
+	}
+	// 4. Check expires_at
 	// 401 "token expired"
 	if time.Now().After(refreshToken.ExpiresAt) {
 		respondWithError(w, http.StatusUnauthorized, "Token has expired", nil)
 		return
 	}
-	// 4. Check revoked_at
-	// 401 "token revoked
-	if refreshToken.RevokedAt.Valid {
+	// 5. Rotate: revoke the presented token and issue its successor
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	rotated, err := cfg.store.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		NewToken:  newToken,
+		OldToken:  token,
+		IpAddress: clientip.FromRequest(r),
+	})
+	if err == sql.ErrNoRows {
+		// Lost a race with another request presenting the same token
+		cfg.revokeRefreshTokenFamily(r, refreshToken)
 		respondWithError(w, http.StatusUnauthorized, "Token has been revoked", nil)
 		return
 	}
-	// 5. Create new JWT
-	accessToken, err := auth.MakeJWT(refreshToken.UserID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
+	// 6. Create new JWT
+	accessToken, err := cfg.keys.MakeSessionJWT(rotated.UserID, rotated.FamilyID, cfg.accessTokenDuration)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT", nil)
 		return
 	}
-	// 6. Return JSON
+	// 7. Return JSON
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	respondWithJSON(w, 200, response{Token: accessToken, RefreshToken: rotated.Token})
+}
+
+func (cfg *apiConfig) revokeRefreshTokenFamily(r *http.Request, reused database.RefreshToken) {
+	logger := logging.FromContext(r.Context())
+	logger.Warn("Refresh token reuse detected, revoking token family",
+		"security", true, "user_id", reused.UserID, "family_id", reused.FamilyID, "client_ip", clientip.FromRequest(r))
+	err := cfg.store.RevokeRefreshTokenFamily(r.Context(), reused.FamilyID)
+	if err != nil {
+		logger.Error("Couldn't revoke token family", "family_id", reused.FamilyID, "error", err)
 	}
-	respondWithJSON(w, 200, response{Token: accessToken})
 
 }
 
@@ -172,7 +267,7 @@ func (cfg *apiConfig) handlerRevokeCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// 2. Update DB
-	err = cfg.db.RevokeRefreshToken(r.Context(), token)
+	err = cfg.store.RevokeRefreshToken(r.Context(), token)
 	if err != nil && err != sql.ErrNoRows {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get info from DB", nil)
 		return
@@ -182,8 +277,9 @@ func (cfg *apiConfig) handlerRevokeCreate(w http.ResponseWriter, r *http.Request
 
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password            string `json:"password"`
+		Email               string `json:"email"`
+		RevokeOtherSessions bool   `json:"revoke_other_sessions"`
 	}
 	type response struct {
 		User
@@ -194,7 +290,7 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, sessionID, err := cfg.keys.ValidateSessionJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
 		return
@@ -206,27 +302,59 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
+	email, err := mail.NormalizeAddress(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address", err)
+		return
+	}
+	current, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		return
+	}
 	hashNewPass, err := auth.HashPassword(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
 		return
 	}
-	updateUser, err := cfg.db.UpdateUser(r.Context(), database.UpdateUserParams{
+	// A new email only replaces the current one once it has been verified
+	updateUser, err := cfg.store.UpdateUser(r.Context(), database.UpdateUserParams{
 		ID:             userID,
-		Email:          params.Email,
+		Email:          current.Email,
 		HashedPassword: hashNewPass,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
 		return
 	}
+	pending := sql.NullString{String: email, Valid: email != current.Email}
+	if pending != current.PendingEmail {
+		err = cfg.store.SetUserPendingEmail(r.Context(), database.SetUserPendingEmailParams{
+			ID:           userID,
+			PendingEmail: pending,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+			return
+		}
+		updateUser.PendingEmail = pending
+		if pending.Valid {
+			cfg.background.Go(func() { cfg.sendEmailVerification(userID, email) })
+		}
+	}
+	if params.RevokeOtherSessions {
+		except := uuid.NullUUID{UUID: sessionID, Valid: sessionID != uuid.Nil}
+		err = cfg.store.RevokeUserSessions(r.Context(), database.RevokeUserSessionsParams{
+			UserID:         userID,
+			ExceptFamilyID: except,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+			return
+		}
+	}
 	respondWithJSON(w, 200, response{
-		User: User{
-			ID:        updateUser.ID,
-			CreatedAt: updateUser.CreatedAt,
-			UpdatedAt: updateUser.UpdatedAt,
-			Email:     updateUser.Email,
-		},
+		User: userFromDB(updateUser),
 	})
 }
 
@@ -238,7 +366,7 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.keys.ValidateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
 		return
@@ -253,8 +381,8 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 3. Проверить существование и владельца
-	chirp, err := cfg.db.GetChirpByID(r.Context(), chirpUUID)
-	if err == sql.ErrNoRows {
+	chirp, err := cfg.store.GetChirpByID(r.Context(), chirpUUID)
+	if err == sql.ErrNoRows || (err == nil && chirp.DeletedAt.Valid) {
 		respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
 		return
 	}
@@ -270,57 +398,21 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 	}
 
 	// 5. Удалить
-	err = cfg.db.DeleteChirp(r.Context(), chirpUUID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
-		return
+	// DeleteChirp leaves chirps with replies alone, checking in the same
+	// statement. Those get a tombstone so the thread stays intact.
+	deleted, err := cfg.store.DeleteChirp(r.Context(), chirpUUID)
+	if err == nil && deleted == 0 {
+		err = cfg.store.TombstoneChirp(r.Context(), chirpUUID)
 	}
-
-	// 6. Успех
-	w.WriteHeader(http.StatusNoContent)
-}
-
-func (cfg *apiConfig) handlerUpgradeUsersToChirpyRed(w http.ResponseWriter, r *http.Request) {
-
-	apiKey, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid API key", nil)
-		return
-	}
-	if apiKey != cfg.polkaKey {
-		respondWithError(w, http.StatusUnauthorized, "Invalid API key", nil)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp", err)
 		return
 	}
-	type Data struct {
+	cfg.outbound.emit(r.Context(), eventChirpDeleted, struct {
+		ID     uuid.UUID `json:"id"`
 		UserID uuid.UUID `json:"user_id"`
-	}
-	type parameters struct {
-		Event string `json:"event"`
-		Data  Data   `json:"data"`
-	}
-
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid JSON", err)
-		return
-	}
-
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	_, err = cfg.db.UpgradeUserToChirpyRed(r.Context(), params.Data.UserID)
-	if err == sql.ErrNoRows {
-		respondWithError(w, http.StatusNotFound, "User not found", nil)
-		return
-	}
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error", nil)
-		return
-	}
+	}{chirp.ID, chirp.UserID}, userID)
 
+	// 6. Успех
 	w.WriteHeader(http.StatusNoContent)
 }
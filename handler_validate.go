@@ -1,10 +1,9 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
-	"sort"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,17 +12,40 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to,omitempty"`
+	ReplyCount int32      `json:"reply_count"`
+	LikeCount  int32      `json:"like_count"`
+	LikedByMe  bool       `json:"liked_by_me"`
+	Deleted    bool       `json:"deleted,omitempty"`
+}
+
+func chirpFromDB(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:         c.ID,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		Body:       c.Body,
+		UserID:     c.UserID,
+		ReplyCount: c.ReplyCount,
+		LikeCount:  c.LikeCount,
+		Deleted:    c.DeletedAt.Valid,
+	}
+	if c.InReplyTo.Valid {
+		chirp.InReplyTo = &c.InReplyTo.UUID
+	}
+	return chirp
 }
 
 func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
 
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
 	type response struct {
 		Chirp
@@ -37,8 +59,7 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	const maxChirpLength = 140
-	if len(params.Body) > maxChirpLength {
+	if len(params.Body) > cfg.maxChirpLength {
 		respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
 		return
 	}
@@ -49,36 +70,53 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.keys.ValidateJWT(token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid token", err)
 		return
 	}
+	if !cfg.requireVerified(w, r, userID, actionChirp) {
+		return
+	}
 
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	inReplyTo := uuid.NullUUID{}
+	if params.InReplyTo != nil {
+		parent, err := cfg.store.GetChirpByID(r.Context(), *params.InReplyTo)
+		if err == sql.ErrNoRows || (err == nil && parent.DeletedAt.Valid) {
+			respondWithError(w, http.StatusBadRequest, "Chirp being replied to doesn't exist", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error", err)
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
 	}
-	cleaned := getCleanedBody(params.Body, badWords)
 
-	chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleaned,
-		UserID: userID,
+	filtered := cfg.filter.Check(params.Body)
+	if filtered.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains banned words", nil)
+		return
+	}
+
+	chirp, err := cfg.store.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:      filtered.Body,
+		UserID:    userID,
+		InReplyTo: inReplyTo,
 	})
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp", err)
 		return
 	}
+	cfg.metrics.chirpsCreated.Inc()
+
+	if filtered.Moderate {
+		cfg.flagForModeration(r.Context(), chirp.ID, filtered.Matches)
+	}
+	cfg.outbound.emit(r.Context(), eventChirpCreated, chirpFromDB(chirp), userID)
 
 	respondWithJSON(w, http.StatusCreated, response{
-		Chirp: Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		},
+		Chirp: chirpFromDB(chirp),
 	})
 
 }
@@ -92,45 +130,63 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 		sortOrder = "asc"
 	}
 
-	var chirps []database.Chirp
-	var err error
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
 
+	author := uuid.NullUUID{}
 	if authorID != "" {
 		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Invalid author_id", err)
 			return
 		}
-		chirps, err = cfg.db.GetChirpsByAuthor(r.Context(), authorUUID)
-	} else {
-		chirps, err = cfg.db.GetAllChirps(r.Context())
+		author = uuid.NullUUID{UUID: authorUUID, Valid: true}
 	}
 
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Paging backwards walks the index in the opposite direction
+	var chirps []database.Chirp
+	if (sortOrder == "desc") != page.backward() {
+		chirps, err = cfg.store.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:        author,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	} else {
+		chirps, err = cfg.store.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:        author,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps", err)
 		return
 	}
 
+	chirps, next, prev := paginate(chirps, page, func(c database.Chirp) pageCursor {
+		return pageCursor{CreatedAt: c.CreatedAt, ID: c.ID}
+	})
+
 	// Convert to response format
-	result := make([]Chirp, len(chirps))
-	for i, dbChirp := range chirps {
-		result[i] = Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		}
+	result, err := cfg.chirpsForViewer(r, chirps)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps", err)
+		return
 	}
 
-	// Sort in-memory
-	sort.Slice(result, func(i, j int) bool {
-		if sortOrder == "desc" {
-			return result[i].CreatedAt.After(result[j].CreatedAt)
-		}
-		return result[i].CreatedAt.Before(result[j].CreatedAt)
-	})
-
+	setPageLinks(w, r, next, prev)
 	respondWithJSON(w, 200, result)
 }
 
@@ -143,29 +199,17 @@ func (cfg *apiConfig) handlerChirpGetId(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chirps, err := cfg.db.GetChirpByID(r.Context(), chirpUUID)
+	chirps, err := cfg.store.GetChirpByID(r.Context(), chirpUUID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get chirp ID", err)
 		return
 	}
 
-	respondWithJSON(w, 200, Chirp{
-		ID:        chirps.ID,
-		CreatedAt: chirps.CreatedAt,
-		UpdatedAt: chirps.UpdatedAt,
-		Body:      chirps.Body,
-		UserID:    chirps.UserID,
-	})
-}
-
-func getCleanedBody(body string, badWords map[string]struct{}) string {
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		loweredWord := strings.ToLower(word)
-		if _, ok := badWords[loweredWord]; ok {
-			words[i] = "****"
-		}
+	result, err := cfg.chirpsForViewer(r, []database.Chirp{chirps})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chirp", err)
+		return
 	}
-	cleaned := strings.Join(words, " ")
-	return cleaned
+
+	respondWithJSON(w, 200, result[0])
 }
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+const maxWebhookEndpointsPerUser = 10
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret is only shown once, when the endpoint is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	ResponseStatus *int32     `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+func webhookEndpointFromDB(e database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        e.ID,
+		URL:       e.Url,
+		Events:    e.Events,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func webhookDeliveryFromDB(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        d.ID,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		LastError: d.LastError.String,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.ResponseStatus.Valid {
+		delivery.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	if d.Status == deliveryPending || d.Status == deliveryFailed {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.DeliveredAt.Valid {
+		delivery.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return delivery
+}
+
+// handlerWebhookEndpointCreate registers a URL to receive the caller's
+// events. The response holds the signing secret, which can't be read back
+// later.
+func (cfg *apiConfig) handlerWebhookEndpointCreate(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	type parameters struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if msg := cfg.validateWebhookURL(params.URL); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	if len(params.Events) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Subscribe to at least one event", nil)
+		return
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(webhookEventTypes, event) {
+			respondWithError(w, http.StatusBadRequest, "Unknown event type "+event, nil)
+			return
+		}
+	}
+	slices.Sort(params.Events)
+	params.Events = slices.Compact(params.Events)
+
+	count, err := cfg.db.CountWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return
+	}
+	if count >= maxWebhookEndpointsPerUser {
+		respondWithError(w, http.StatusConflict, "Too many webhook endpoints", nil)
+		return
+	}
+
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret", err)
+		return
+	}
+	endpoint, err := cfg.db.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID: userID,
+		Url:    params.URL,
+		Secret: "whsec_" + secret,
+		Events: params.Events,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create webhook endpoint", err)
+		return
+	}
+
+	resp := webhookEndpointFromDB(endpoint)
+	resp.Secret = endpoint.Secret
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// validateWebhookURL returns what is wrong with a webhook URL, if anything.
+// Plain HTTP is only accepted in dev.
+func (cfg *apiConfig) validateWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "Invalid URL"
+	}
+	if u.User != nil {
+		return "URL must not contain credentials"
+	}
+	if u.Scheme != "https" && (u.Scheme != "http" || cfg.platform != "dev") {
+		return "URL must use https"
+	}
+	return ""
+}
+
+func (cfg *apiConfig) handlerWebhookEndpointsGet(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook endpoints", err)
+		return
+	}
+
+	endpoints := make([]WebhookEndpoint, len(rows))
+	for i, row := range rows {
+		endpoints[i] = webhookEndpointFromDB(row)
+	}
+	respondWithJSON(w, http.StatusOK, endpoints)
+}
+
+// handlerWebhookEndpointDelete removes an endpoint along with its pending
+// deliveries and log.
+func (cfg *apiConfig) handlerWebhookEndpointDelete(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid endpoint ID", err)
+		return
+	}
+
+	rows, err := cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete webhook endpoint", err)
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerWebhookDeliveriesGet is the delivery log of an endpoint, newest
+// first.
+func (cfg *apiConfig) handlerWebhookDeliveriesGet(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.webhookEndpointRequest(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	// Newest first; paging backwards walks the other way
+	var rows []database.WebhookDelivery
+	if page.backward() {
+		rows, err = cfg.db.ListWebhookDeliveriesAsc(r.Context(), database.ListWebhookDeliveriesAscParams{
+			EndpointID:      endpoint.ID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	} else {
+		rows, err = cfg.db.ListWebhookDeliveriesDesc(r.Context(), database.ListWebhookDeliveriesDescParams{
+			EndpointID:      endpoint.ID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			RowLimit:        int32(page.Limit + 1),
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get webhook deliveries", err)
+		return
+	}
+
+	rows, next, prev := paginate(rows, page, func(row database.WebhookDelivery) pageCursor {
+		return pageCursor{CreatedAt: row.CreatedAt, ID: row.ID}
+	})
+
+	deliveries := make([]WebhookDelivery, len(rows))
+	for i, row := range rows {
+		deliveries[i] = webhookDeliveryFromDB(row)
+	}
+	setPageLinks(w, r, next, prev)
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// handlerWebhookEndpointPing queues a ping event so integrations can check
+// their endpoint and signature handling. The outcome shows up in the
+// delivery log.
+func (cfg *apiConfig) handlerWebhookEndpointPing(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.webhookEndpointRequest(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := cfg.outbound.ping(r.Context(), endpoint.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue ping", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, webhookDeliveryFromDB(delivery))
+}
+
+// webhookEndpointRequest authenticates the caller and loads the endpoint in
+// the path, which must be theirs. It writes the error response itself.
+func (cfg *apiConfig) webhookEndpointRequest(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	userID, _, ok := cfg.sessionRequest(w, r)
+	if !ok {
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid endpoint ID", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Webhook endpoint not found", nil)
+		return database.WebhookEndpoint{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error", err)
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/mail"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/storage"
+)
+
+// testServer runs the handlers over the in-memory store, as with
+// STORAGE=memory. Unverified accounts may do anything unless a test sets
+// unverifiedPolicy.
+func testServer(t *testing.T) (*apiConfig, http.Handler) {
+	t.Helper()
+	key := auth.NewHMACKey("test", []byte("secret"))
+	keys := auth.NewKeySet("")
+	if err := keys.SetKeys(key, []*auth.Key{key}); err != nil {
+		t.Fatal(err)
+	}
+	chirpFilter, err := loadFilter(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &apiConfig{
+		metrics: newAppMetrics(metrics.NewRegistry()),
+		store:   storage.NewMemoryStore(),
+		keys:    keys,
+		filter:  chirpFilter,
+		mailer:  &mail.LogMailer{Logger: log.New(io.Discard, "", 0)},
+
+		unverifiedPolicy: unverifiedAllow,
+
+		accessTokenDuration:  time.Hour,
+		refreshTokenDuration: 24 * time.Hour,
+
+		maxChirpLength:     140,
+		chirpEditWindow:    time.Hour,
+		chirpEditWindowRed: time.Hour,
+	}
+	t.Cleanup(cfg.background.Wait)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("POST /api/login", cfg.handlerUsersLogin)
+	mux.HandleFunc("POST /api/refresh", cfg.handlerRefreshCreate)
+	mux.HandleFunc("POST /api/revoke", cfg.handlerRevokeCreate)
+	mux.HandleFunc("GET /api/sessions", cfg.handlerSessionsGet)
+	mux.HandleFunc("DELETE /api/sessions", cfg.handlerSessionsDelete)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerSessionDelete)
+	mux.HandleFunc("POST /api/chirps", cfg.handlerChirpsCreate)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerChirpGetId)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.handlerChirpUpdate)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerChirpDelete)
+	return cfg, mux
+}
+
+// call sends a request with an optional bearer token and JSON body, and
+// fails the test unless the response has the wanted status. The response
+// body is decoded into out when it isn't nil.
+func call(t *testing.T, h http.Handler, method, path, token string, body any, want int, out any) {
+	t.Helper()
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != want {
+		t.Fatalf("%s %s: expected %d, got %d: %s", method, path, want, rec.Code, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+type credentials struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+func signup(t *testing.T, h http.Handler, email string) User {
+	t.Helper()
+	var user User
+	call(t, h, "POST", "/api/users", "", credentials{Email: email, Password: "hunter22"}, http.StatusCreated, &user)
+	return user
+}
+
+func login(t *testing.T, h http.Handler, email, device string) User {
+	t.Helper()
+	var user User
+	call(t, h, "POST", "/api/login", "", credentials{Email: email, Password: "hunter22", DeviceName: device}, http.StatusOK, &user)
+	return user
+}
+
+func TestSignupAndLogin(t *testing.T) {
+	_, h := testServer(t)
+
+	user := signup(t, h, "Alice@Example.com")
+	if user.Email != "alice@example.com" {
+		t.Errorf("expected the email lowercased, got %q", user.Email)
+	}
+	if user.Token != "" || user.EmailVerified {
+		t.Errorf("signup shouldn't log in or verify: %+v", user)
+	}
+	call(t, h, "POST", "/api/users", "", credentials{Email: "ALICE@example.com", Password: "x"}, http.StatusConflict, nil)
+	call(t, h, "POST", "/api/users", "", credentials{Email: "not an address", Password: "x"}, http.StatusBadRequest, nil)
+
+	call(t, h, "POST", "/api/login", "", credentials{Email: "alice@example.com", Password: "wrong"}, http.StatusUnauthorized, nil)
+	call(t, h, "POST", "/api/login", "", credentials{Email: "bob@example.com", Password: "hunter22"}, http.StatusUnauthorized, nil)
+
+	loggedIn := login(t, h, "ALICE@example.COM", "")
+	if loggedIn.ID != user.ID || loggedIn.Token == "" || loggedIn.Refresh_token == "" {
+		t.Fatalf("unexpected login response %+v", loggedIn)
+	}
+	call(t, h, "GET", "/api/sessions", loggedIn.Token, nil, http.StatusOK, nil)
+	call(t, h, "GET", "/api/sessions", "not-a-jwt", nil, http.StatusUnauthorized, nil)
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	_, h := testServer(t)
+	signup(t, h, "alice@example.com")
+	user := login(t, h, "alice@example.com", "")
+
+	type tokens struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	var first tokens
+	call(t, h, "POST", "/api/refresh", user.Refresh_token, nil, http.StatusOK, &first)
+	if first.Token == "" || first.RefreshToken == "" || first.RefreshToken == user.Refresh_token {
+		t.Fatalf("expected a new token pair, got %+v", first)
+	}
+	var second tokens
+	call(t, h, "POST", "/api/refresh", first.RefreshToken, nil, http.StatusOK, &second)
+
+	// Replaying a rotated token revokes the whole family, including the
+	// token that replaced it
+	call(t, h, "POST", "/api/refresh", user.Refresh_token, nil, http.StatusUnauthorized, nil)
+	call(t, h, "POST", "/api/refresh", second.RefreshToken, nil, http.StatusUnauthorized, nil)
+
+	// Other logins are left alone
+	other := login(t, h, "alice@example.com", "")
+	call(t, h, "POST", "/api/refresh", other.Refresh_token, nil, http.StatusOK, nil)
+
+	call(t, h, "POST", "/api/revoke", other.Refresh_token, nil, http.StatusNoContent, nil)
+	call(t, h, "POST", "/api/refresh", other.Refresh_token, nil, http.StatusUnauthorized, nil)
+}
+
+func TestChirpLifecycle(t *testing.T) {
+	cfg, h := testServer(t)
+	signup(t, h, "alice@example.com")
+	signup(t, h, "bob@example.com")
+	alice := login(t, h, "alice@example.com", "")
+	bob := login(t, h, "bob@example.com", "")
+
+	type chirpBody struct {
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	}
+	var chirp Chirp
+	call(t, h, "POST", "/api/chirps", alice.Token, chirpBody{Body: "What a Kerfuffle!"}, http.StatusCreated, &chirp)
+	if chirp.Body != "What a ****!" || chirp.UserID != alice.ID {
+		t.Errorf("expected the default terms to be masked, got %+v", chirp)
+	}
+	call(t, h, "POST", "/api/chirps", "", chirpBody{Body: "hello"}, http.StatusUnauthorized, nil)
+	call(t, h, "POST", "/api/chirps", alice.Token, chirpBody{Body: string(make([]byte, 141))}, http.StatusBadRequest, nil)
+
+	path := "/api/chirps/" + chirp.ID.String()
+	call(t, h, "PUT", path, bob.Token, chirpBody{Body: "mine now"}, http.StatusForbidden, nil)
+	var edited Chirp
+	call(t, h, "PUT", path, alice.Token, chirpBody{Body: "edited"}, http.StatusOK, &edited)
+	if edited.Body != "edited" {
+		t.Errorf("expected the edit to be saved, got %q", edited.Body)
+	}
+	cfg.chirpEditWindow = 0
+	call(t, h, "PUT", path, alice.Token, chirpBody{Body: "too late"}, http.StatusForbidden, nil)
+
+	// A chirp with replies becomes a tombstone so the thread stays intact
+	var reply Chirp
+	call(t, h, "POST", "/api/chirps", bob.Token, chirpBody{Body: "reply", InReplyTo: &chirp.ID}, http.StatusCreated, &reply)
+	call(t, h, "DELETE", path, bob.Token, nil, http.StatusForbidden, nil)
+	call(t, h, "DELETE", path, alice.Token, nil, http.StatusNoContent, nil)
+	var tombstone Chirp
+	call(t, h, "GET", path, "", nil, http.StatusOK, &tombstone)
+	if !tombstone.Deleted || tombstone.Body != "" {
+		t.Errorf("expected a tombstone, got %+v", tombstone)
+	}
+	call(t, h, "DELETE", path, alice.Token, nil, http.StatusNotFound, nil)
+
+	// Without replies the chirp is gone
+	replyPath := "/api/chirps/" + reply.ID.String()
+	call(t, h, "DELETE", replyPath, bob.Token, nil, http.StatusNoContent, nil)
+	call(t, h, "GET", replyPath, "", nil, http.StatusNotFound, nil)
+}
+
+func TestChirpsNeedVerifiedEmail(t *testing.T) {
+	cfg, h := testServer(t)
+	cfg.unverifiedPolicy = unverifiedNoChirps
+	signup(t, h, "alice@example.com")
+	alice := login(t, h, "alice@example.com", "")
+
+	call(t, h, "POST", "/api/chirps", alice.Token, map[string]string{"body": "hello"}, http.StatusForbidden, nil)
+	call(t, h, "GET", "/api/sessions", alice.Token, nil, http.StatusOK, nil)
+}
+
+func TestSessions(t *testing.T) {
+	_, h := testServer(t)
+	signup(t, h, "alice@example.com")
+	signup(t, h, "bob@example.com")
+	laptop := login(t, h, "alice@example.com", "Laptop")
+	phone := login(t, h, "alice@example.com", "Phone")
+	bob := login(t, h, "bob@example.com", "")
+
+	var sessions []Session
+	call(t, h, "GET", "/api/sessions", laptop.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	var current, other Session
+	for _, s := range sessions {
+		if s.Current {
+			current = s
+		} else {
+			other = s
+		}
+	}
+	if current.DeviceLabel != "Laptop" || other.DeviceLabel != "Phone" {
+		t.Errorf("unexpected sessions %+v", sessions)
+	}
+
+	// Users can only end their own sessions
+	call(t, h, "DELETE", "/api/sessions/"+other.ID.String(), bob.Token, nil, http.StatusNotFound, nil)
+	call(t, h, "DELETE", "/api/sessions/not-a-uuid", laptop.Token, nil, http.StatusBadRequest, nil)
+	call(t, h, "DELETE", "/api/sessions/"+other.ID.String(), laptop.Token, nil, http.StatusNoContent, nil)
+	call(t, h, "POST", "/api/refresh", phone.Refresh_token, nil, http.StatusUnauthorized, nil)
+	call(t, h, "POST", "/api/refresh", laptop.Refresh_token, nil, http.StatusOK, nil)
+
+	call(t, h, "GET", "/api/sessions", laptop.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].ID != current.ID {
+		t.Errorf("expected only the current session, got %+v", sessions)
+	}
+
+	call(t, h, "DELETE", "/api/sessions", laptop.Token, nil, http.StatusNoContent, nil)
+	call(t, h, "GET", "/api/sessions", laptop.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %+v", sessions)
+	}
+	call(t, h, "POST", "/api/refresh", bob.Refresh_token, nil, http.StatusOK, nil)
+}
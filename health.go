@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/health"
+)
+
+//go:embed sql/schema/*.sql
+var schemaFS embed.FS
+
+// expectedMigration is the version of the newest goose migration built into
+// the binary.
+func expectedMigration() (int64, error) {
+	files, err := fs.Glob(schemaFS, "sql/schema/*.sql")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, name := range files {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "sql/schema/"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version prefix", name)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// migrationCheck fails until the database has been migrated to the schema
+// this binary expects, so a rollout waits for goose to run. Newer migrations
+// are fine: during a rolling deploy the old pods keep serving until the new
+// ones are ready.
+func migrationCheck(db *sql.DB, expected int64) health.Check {
+	return func(ctx context.Context) error {
+		var version int64
+		err := db.QueryRowContext(ctx,
+			"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&version)
+		if err != nil {
+			return err
+		}
+		if version < expected {
+			return fmt.Errorf("database is at migration %d, expected at least %d", version, expected)
+		}
+		return nil
+	}
+}
+
+func (cfg *apiConfig) drainingCheck(ctx context.Context) error {
+	if cfg.draining.Load() {
+		return errors.New("shutting down")
+	}
+	return nil
+}
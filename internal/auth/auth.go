@@ -2,9 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -23,39 +23,33 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// Claims are the registered JWT claims plus the login session the access
+// token was issued for.
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+}
+
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	createToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Issuer: "chirpy", IssuedAt: jwt.NewNumericDate(time.Now().UTC()), ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)), Subject: userID.String()})
+	return MakeSessionJWT(userID, uuid.Nil, tokenSecret, expiresIn)
+}
 
-	signedToken, err := createToken.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
-	}
-	return signedToken, nil
+func MakeSessionJWT(userID, sessionID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, sessionID, "", NewHMACKey("", []byte(tokenSecret)), expiresIn)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-		return uuid.Nil, errors.New("unexpected signing method")
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.Nil, errors.New("invalid token claims")
-	}
-
-	userID, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, err
-	}
+	userID, _, err := ValidateSessionJWT(tokenString, tokenSecret)
+	return userID, err
+}
 
-	return userID, nil
+// ValidateSessionJWT is ValidateJWT that also returns the session ID, or
+// uuid.Nil for tokens issued without one.
+func ValidateSessionJWT(tokenString, tokenSecret string) (userID, sessionID uuid.UUID, err error) {
+	key := NewHMACKey("", []byte(tokenSecret))
+	return validateJWT(tokenString, "", func(*jwt.Token) (*Key, error) {
+		return key, nil
+	})
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -82,6 +76,13 @@ func MakeRefreshToken() (string, error) {
 	return encodedStr, nil
 }
 
+// HashToken hashes a random single-use token for storage, so a leaked
+// database doesn't hand out working tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
@@ -61,3 +61,35 @@ func TestValidateJWT_WrongSecret(t *testing.T) {
 		t.Error("expected error for wrong secret, got nil")
 	}
 }
+
+func TestMakeAndValidateSessionJWT(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+	secret := "test-secret"
+
+	token, err := MakeSessionJWT(userID, sessionID, secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeSessionJWT failed: %v", err)
+	}
+
+	gotUser, gotSession, err := ValidateSessionJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ValidateSessionJWT failed: %v", err)
+	}
+	if gotUser != userID || gotSession != sessionID {
+		t.Errorf("expected %v/%v, got %v/%v", userID, sessionID, gotUser, gotSession)
+	}
+
+	// Tokens without a session still validate
+	token, err = MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	_, gotSession, err = ValidateSessionJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ValidateSessionJWT failed: %v", err)
+	}
+	if gotSession != uuid.Nil {
+		t.Errorf("expected no session, got %v", gotSession)
+	}
+}
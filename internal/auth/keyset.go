@@ -0,0 +1,438 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// AudienceMFAChallenge is the audience of tokens issued between the password
+// and the second factor of a login.
+const AudienceMFAChallenge = "chirpy-mfa"
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is a JWT signing key. Keys loaded from public key material can only
+// verify tokens.
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+
+	signKey   crypto.PrivateKey
+	verifyKey crypto.PublicKey
+}
+
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: AlgHS256, signKey: secret, verifyKey: secret}
+}
+
+// GenerateKey creates a fresh asymmetric key with a random ID.
+func GenerateKey(alg string) (*Key, error) {
+	id := uuid.NewString()
+	switch alg {
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Algorithm: AlgRS256, CreatedAt: time.Now(), signKey: priv, verifyKey: &priv.PublicKey}, nil
+	case AlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{ID: id, Algorithm: AlgEdDSA, CreatedAt: time.Now(), signKey: priv, verifyKey: pub}, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// ParsePEMKey reads an RSA or Ed25519 key. Private keys may be PKCS#8 or
+// PKCS#1, public keys PKIX.
+func ParsePEMKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Algorithm: AlgRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Algorithm: AlgRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: AlgEdDSA, signKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Algorithm: AlgEdDSA, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// MarshalPEM encodes the private part of an asymmetric key as PKCS#8.
+func (k *Key) MarshalPEM() ([]byte, error) {
+	if k.Algorithm == AlgHS256 || !k.CanSign() {
+		return nil, errors.New("only asymmetric private keys can be exported")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.signKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// sealedKeyPrefix versions the format written by SealKey.
+const sealedKeyPrefix = "v1:"
+
+// SealKey encrypts the private key for storage with AES-256-GCM under a key
+// derived from secret. The key ID is authenticated too, so a sealed key
+// can't be moved to another ID.
+func SealKey(k *Key, secret string) (string, error) {
+	data, err := k.MarshalPEM()
+	if err != nil {
+		return "", err
+	}
+	aead, err := sealingAEAD(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, data, []byte(k.ID))
+	return sealedKeyPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenKey decrypts a key written by SealKey.
+func OpenKey(id, sealed, secret string) (*Key, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedKeyPrefix)
+	if !ok {
+		return nil, errors.New("key is not sealed")
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := sealingAEAD(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed key is too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, errors.New("couldn't decrypt key, wrong secret?")
+	}
+	return ParsePEMKey(id, plain)
+}
+
+func sealingAEAD(secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("no key encryption secret set")
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadKeyDir loads every *.pem file in dir, using the file name without
+// extension as the key ID.
+func LoadKeyDir(dir string) ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParsePEMKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet signs tokens with its current key and accepts tokens signed by
+// any key it holds. Tokens without a kid header are checked against the
+// legacy HS256 secret, if one is set.
+type KeySet struct {
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+	legacy  *Key
+}
+
+func NewKeySet(legacySecret string) *KeySet {
+	ks := &KeySet{keys: map[string]*Key{}}
+	if legacySecret != "" {
+		ks.legacy = NewHMACKey("", []byte(legacySecret))
+	}
+	return ks
+}
+
+// SetKeys replaces the verification keys and makes signing the current
+// signing key. signing is always accepted for verification as well.
+func (ks *KeySet) SetKeys(signing *Key, keys []*Key) error {
+	if signing == nil || !signing.CanSign() {
+		return errors.New("signing key must include private key material")
+	}
+	m := make(map[string]*Key, len(keys))
+	for _, k := range keys {
+		m[k.ID] = k
+	}
+	m[signing.ID] = signing
+
+	ks.mu.Lock()
+	ks.signing = signing
+	ks.keys = m
+	ks.mu.Unlock()
+	return nil
+}
+
+// Rotate makes key the signing key, keeping the previous keys around to
+// verify tokens they already issued.
+func (ks *KeySet) Rotate(key *Key) error {
+	if !key.CanSign() {
+		return errors.New("signing key must include private key material")
+	}
+	ks.mu.Lock()
+	ks.keys[key.ID] = key
+	ks.signing = key
+	ks.mu.Unlock()
+	return nil
+}
+
+// Remove stops accepting tokens signed by the given key. The current
+// signing key can't be removed.
+func (ks *KeySet) Remove(id string) {
+	ks.mu.Lock()
+	if ks.signing == nil || ks.signing.ID != id {
+		delete(ks.keys, id)
+	}
+	ks.mu.Unlock()
+}
+
+func (ks *KeySet) SigningKey() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.signing
+}
+
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.MakeSessionJWT(userID, uuid.Nil, expiresIn)
+}
+
+func (ks *KeySet) MakeSessionJWT(userID, sessionID uuid.UUID, expiresIn time.Duration) (string, error) {
+	key := ks.SigningKey()
+	if key == nil {
+		return "", errors.New("no signing key configured")
+	}
+	return makeJWT(userID, sessionID, "", key, expiresIn)
+}
+
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	userID, _, err := ks.ValidateSessionJWT(tokenString)
+	return userID, err
+}
+
+func (ks *KeySet) ValidateSessionJWT(tokenString string) (userID, sessionID uuid.UUID, err error) {
+	return validateJWT(tokenString, "", ks.lookup)
+}
+
+// MakeMFAChallenge issues a token proving only that the password step of a
+// two-step login succeeded. Its audience keeps it from being accepted as an
+// access token.
+func (ks *KeySet) MakeMFAChallenge(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	key := ks.SigningKey()
+	if key == nil {
+		return "", errors.New("no signing key configured")
+	}
+	return makeJWT(userID, uuid.Nil, AudienceMFAChallenge, key, expiresIn)
+}
+
+func (ks *KeySet) ValidateMFAChallenge(tokenString string) (uuid.UUID, error) {
+	userID, _, err := validateJWT(tokenString, AudienceMFAChallenge, ks.lookup)
+	return userID, err
+}
+
+func (ks *KeySet) lookup(token *jwt.Token) (*Key, error) {
+	kid, _ := token.Header["kid"].(string)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if kid == "" {
+		if ks.legacy == nil {
+			return nil, errors.New("token has no key ID")
+		}
+		return ks.legacy, nil
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+// JWK is a public key in RFC 7517 format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public halves of all asymmetric keys. HMAC secrets are
+// never published.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+func makeJWT(userID, sessionID uuid.UUID, audience string, key *Key, expiresIn time.Duration) (string, error) {
+	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "chirpy", IssuedAt: jwt.NewNumericDate(time.Now().UTC()), ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)), Subject: userID.String()}}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+	createToken := jwt.NewWithClaims(key.method(), claims)
+	if key.ID != "" {
+		createToken.Header["kid"] = key.ID
+	}
+
+	signedToken, err := createToken.SignedString(key.signKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signedToken, nil
+}
+
+// validateJWT checks the signature, expiry and audience. Tokens meant for a
+// specific audience are never valid where none is expected.
+func validateJWT(tokenString, audience string, lookup func(*jwt.Token) (*Key, error)) (userID, sessionID uuid.UUID, err error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		key, err := lookup(token)
+		if err != nil {
+			return nil, err
+		}
+		// Never let the token pick the algorithm
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return uuid.Nil, uuid.Nil, errors.New("invalid token claims")
+	}
+	if (audience == "" && len(claims.Audience) > 0) || (audience != "" && !claims.VerifyAudience(audience, true)) {
+		return uuid.Nil, uuid.Nil, errors.New("invalid token audience")
+	}
+
+	userID, err = uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if claims.SessionID != "" {
+		sessionID, err = uuid.Parse(claims.SessionID)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+	}
+
+	return userID, sessionID, nil
+}
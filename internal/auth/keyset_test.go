@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			ks := NewKeySet("")
+			old, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatalf("GenerateKey failed: %v", err)
+			}
+			if err := ks.Rotate(old); err != nil {
+				t.Fatal(err)
+			}
+
+			userID := uuid.New()
+			token, err := ks.MakeJWT(userID, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT failed: %v", err)
+			}
+
+			next, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ks.Rotate(next); err != nil {
+				t.Fatal(err)
+			}
+
+			// Токен старого ключа всё ещё валиден
+			got, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("ValidateJWT after rotation failed: %v", err)
+			}
+			if got != userID {
+				t.Errorf("expected %v, got %v", userID, got)
+			}
+
+			ks.Remove(old.ID)
+			if _, err := ks.ValidateJWT(token); err == nil {
+				t.Error("expected error for token signed by removed key")
+			}
+		})
+	}
+}
+
+func TestKeySetLegacyToken(t *testing.T) {
+	ks := NewKeySet("legacy-secret")
+	key, err := GenerateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Rotate(key); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	token, err := MakeJWT(userID, "legacy-secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ks.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("ValidateJWT failed for token without kid: %v", err)
+	}
+	if got != userID {
+		t.Errorf("expected %v, got %v", userID, got)
+	}
+}
+
+func TestKeySetRejectsAlgorithmSwitch(t *testing.T) {
+	ks := NewKeySet("")
+	key, err := GenerateKey(AlgRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Rotate(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 токен с kid RSA-ключа не должен проходить проверку
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: uuid.NewString()}})
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString([]byte("anything"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Error("expected error for token with mismatched algorithm")
+	}
+}
+
+func TestLoadKeyDirAndJWKS(t *testing.T) {
+	dir := t.TempDir()
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		key, err := GenerateKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := key.MarshalPEM()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, alg+".pem"), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := LoadKeyDir(dir)
+	if err != nil {
+		t.Fatalf("LoadKeyDir failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+
+	ks := NewKeySet("")
+	hmac := NewHMACKey("shared", []byte("secret"))
+	if err := ks.SetKeys(keys[0], append(keys, hmac)); err != nil {
+		t.Fatal(err)
+	}
+
+	set := ks.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 public keys, got %+v", set.Keys)
+	}
+	if set.Keys[0].KeyID != AlgEdDSA || set.Keys[0].KeyType != "OKP" || set.Keys[0].X == "" {
+		t.Errorf("unexpected Ed25519 JWK: %+v", set.Keys[0])
+	}
+	if set.Keys[1].KeyID != AlgRS256 || set.Keys[1].KeyType != "RSA" || set.Keys[1].N == "" || set.Keys[1].E != "AQAB" {
+		t.Errorf("unexpected RSA JWK: %+v", set.Keys[1])
+	}
+}
+
+func TestSealKey(t *testing.T) {
+	key, err := GenerateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealKey(key, "storage-secret")
+	if err != nil {
+		t.Fatalf("SealKey failed: %v", err)
+	}
+	if strings.Contains(sealed, "PRIVATE KEY") {
+		t.Fatalf("sealed key is readable: %s", sealed)
+	}
+
+	opened, err := OpenKey(key.ID, sealed, "storage-secret")
+	if err != nil {
+		t.Fatalf("OpenKey failed: %v", err)
+	}
+	token, err := makeJWT(uuid.New(), uuid.Nil, "", opened, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := NewKeySet("")
+	if err := ks.Rotate(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(token); err != nil {
+		t.Errorf("token signed with the opened key doesn't verify: %v", err)
+	}
+
+	if _, err := OpenKey(key.ID, sealed, "other-secret"); err == nil {
+		t.Error("expected error opening with the wrong secret")
+	}
+	if _, err := OpenKey("other-kid", sealed, "storage-secret"); err == nil {
+		t.Error("expected error opening under another key ID")
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Тестовый вектор из RFC 6238, секрет "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	prev, _ := TOTPCode(rfcSecret, now.Add(-30*time.Second))
+	if _, ok := ValidateTOTP(rfcSecret, prev, now); !ok {
+		t.Error("expected code from previous step to be accepted")
+	}
+
+	old, _ := TOTPCode(rfcSecret, now.Add(-90*time.Second))
+	if _, ok := ValidateTOTP(rfcSecret, old, now); ok {
+		t.Error("expected code from three steps ago to be rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(codes[0])) {
+		t.Error("expected hash to ignore case and surrounding whitespace")
+	}
+}
+
+func TestMFAChallengeIsNotAnAccessToken(t *testing.T) {
+	ks := NewKeySet("")
+	key, err := GenerateKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Rotate(key); err != nil {
+		t.Fatal(err)
+	}
+
+	userID := uuid.New()
+	challenge, err := ks.MakeMFAChallenge(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(challenge); err == nil {
+		t.Error("expected MFA challenge to be rejected as an access token")
+	}
+	got, err := ks.ValidateMFAChallenge(challenge)
+	if err != nil || got != userID {
+		t.Errorf("ValidateMFAChallenge = %v, %v", got, err)
+	}
+
+	access, err := ks.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateMFAChallenge(access); err == nil {
+		t.Error("expected access token to be rejected as an MFA challenge")
+	}
+}
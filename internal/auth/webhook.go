@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSignature        = errors.New("webhook signature missing")
+	ErrSignatureMalformed = errors.New("webhook signature malformed")
+	ErrSignatureExpired   = errors.New("webhook timestamp outside tolerance")
+	ErrSignatureMismatch  = errors.New("webhook signature doesn't match")
+)
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSignatureHeader formats a signature header for body, one v1 entry
+// per secret.
+func WebhookSignatureHeader(secrets []string, timestamp int64, body []byte) string {
+	parts := []string{"t=" + strconv.FormatInt(timestamp, 10)}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+SignWebhook(secret, timestamp, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// VerifyWebhookSignature checks a header like "t=1700000000,v1=<hex>".
+// There may be several v1 entries, and any of them may match any of the
+// secrets, so senders and receivers can rotate secrets independently. It
+// returns the signed timestamp.
+func VerifyWebhookSignature(header string, body []byte, secrets []string, tolerance time.Duration, now time.Time) (time.Time, error) {
+	if header == "" {
+		return time.Time{}, ErrNoSignature
+	}
+
+	var timestamp int64
+	var haveTimestamp bool
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return time.Time{}, ErrSignatureMalformed
+		}
+		switch k {
+		case "t":
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return time.Time{}, ErrSignatureMalformed
+			}
+			timestamp, haveTimestamp = ts, true
+		case "v1":
+			sig, err := hex.DecodeString(v)
+			if err != nil {
+				return time.Time{}, ErrSignatureMalformed
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	if !haveTimestamp || len(signatures) == 0 {
+		return time.Time{}, ErrSignatureMalformed
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	if d := now.Sub(signedAt); d > tolerance || d < -tolerance {
+		return time.Time{}, ErrSignatureExpired
+	}
+
+	for _, secret := range secrets {
+		expected, _ := hex.DecodeString(SignWebhook(secret, timestamp, body))
+		for _, sig := range signatures {
+			if hmac.Equal(sig, expected) {
+				return signedAt, nil
+			}
+		}
+	}
+	return time.Time{}, ErrSignatureMismatch
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"event":"user.upgraded"}`)
+	header := WebhookSignatureHeader([]string{"new-secret"}, now.Unix(), body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secrets []string
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", header, body, []string{"new-secret"}, now, nil},
+		{"rotated secrets", header, body, []string{"old-secret", "new-secret"}, now, nil},
+		{"wrong secret", header, body, []string{"other"}, now, ErrSignatureMismatch},
+		{"tampered body", header, []byte(`{"event":"user.downgraded"}`), []string{"new-secret"}, now, ErrSignatureMismatch},
+		{"too old", header, body, []string{"new-secret"}, now.Add(10 * time.Minute), ErrSignatureExpired},
+		{"from the future", header, body, []string{"new-secret"}, now.Add(-10 * time.Minute), ErrSignatureExpired},
+		{"missing", "", body, []string{"new-secret"}, now, ErrNoSignature},
+		{"no timestamp", "v1=abcd", body, []string{"new-secret"}, now, ErrSignatureMalformed},
+		{"bad hex", "t=1700000000,v1=zz", body, []string{"new-secret"}, now, ErrSignatureMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyWebhookSignature(tt.header, tt.body, tt.secrets, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package clientip finds the address of the client behind a request. The
+// X-Forwarded-For header is only believed when it was added by one of the
+// configured proxies, since anyone else can set it to anything.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver knows which proxies in front of the server to trust.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver takes the addresses or CIDR ranges of trusted proxies, such
+// as "10.0.0.0/8" or "192.0.2.1". With none, the connection's remote
+// address is always the client.
+func NewResolver(trusted []string) (*Resolver, error) {
+	res := &Resolver{}
+	for _, s := range trusted {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			res.trusted = append(res.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", s)
+		}
+		addr = addr.Unmap()
+		res.trusted = append(res.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return res, nil
+}
+
+// IP returns the client address of r. When the request came through
+// trusted proxies, X-Forwarded-For is read from the right, and the first
+// address that isn't a trusted proxy is the client.
+func (res *Resolver) IP(r *http.Request) string {
+	remote := remoteHost(r.RemoteAddr)
+	client, ok := parseAddr(remote)
+	if !ok || !res.trusts(client) {
+		return remote
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = hop
+		if !res.trusts(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (res *Resolver) trusts(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+// Middleware resolves the client address once per request, for
+// FromRequest.
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxKey{}, res.IP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromRequest returns the client address Middleware resolved, or the
+// connection's remote address outside of it.
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// forwardedFor joins every X-Forwarded-For header into one list of hops,
+// client first.
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseAddr accepts an address with or without a port.
+func parseAddr(s string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,77 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolverIP(t *testing.T) {
+	res, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted sender can't spoof", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"through a proxy", "10.1.2.3:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client supplied hops are skipped", "10.1.2.3:5000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "192.0.2.1:5000", []string{"198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"repeated headers", "10.1.2.3:5000", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"hop with a port", "10.1.2.3:5000", []string{"198.51.100.1:443"}, "198.51.100.1"},
+		{"garbage stops the walk", "10.1.2.3:5000", []string{"198.51.100.1, nonsense, 10.0.0.2"}, "10.0.0.2"},
+		{"proxy without header", "10.1.2.3:5000", nil, "10.1.2.3"},
+		{"ipv6", "[2001:db8::1]:5000", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := res.IP(r); got != tt.want {
+				t.Errorf("IP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResolverRejectsGarbage(t *testing.T) {
+	if _, err := NewResolver([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected error for an invalid range")
+	}
+	if _, err := NewResolver([]string{"proxy.internal"}); err == nil {
+		t.Error("expected error for a host name")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	res, err := NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	h := res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got != "198.51.100.1" {
+		t.Errorf("FromRequest() = %q, want 198.51.100.1", got)
+	}
+
+	if ip := FromRequest(r); ip != "10.0.0.1" {
+		t.Errorf("FromRequest() outside the middleware = %q, want the remote address", ip)
+	}
+}
@@ -0,0 +1,270 @@
+// Package config loads the server configuration.
+//
+// Every setting has an environment variable name. Values come from, in
+// order of precedence:
+//
+//  1. the environment (main loads .env into it without overriding)
+//  2. the config file, if one is given
+//  3. the default in the field's tag
+//
+// Within each source, NAME wins over NAME_FILE, which names a file holding
+// the value, for secrets mounted by Docker or Kubernetes. Empty values are
+// treated as unset.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port         string `env:"PORT" default:"8080"`
+	FilepathRoot string `env:"FILEPATH_ROOT" default:"."`
+	Platform     string `env:"PLATFORM" required:"true"`
+	// TrustedProxies lists the load balancers, by address or CIDR range,
+	// whose X-Forwarded-For header names the client
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// STORAGE=memory keeps users, chirps and sessions in process, for demos
+	// and tests. Everything else needs Postgres and is switched off.
+	Storage           string        `env:"STORAGE" default:"postgres" oneof:"postgres memory"`
+	DBURL             string        `env:"DB_URL" secret:"true"`
+	DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" default:"25"`
+	DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" default:"25"`
+	DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	DBConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+
+	JWTSecret            string        `env:"BEARER" required:"true" secret:"true"`
+	JWTKeySource         string        `env:"JWT_KEY_SOURCE" default:"secret" oneof:"secret file db"`
+	JWTKeysDir           string        `env:"JWT_KEYS_DIR"`
+	JWTSigningKID        string        `env:"JWT_SIGNING_KID"`
+	JWTKeyEncryptionKey  string        `env:"JWT_KEY_ENCRYPTION_KEY" secret:"true"`
+	JWTAlgorithm         string        `env:"JWT_ALGORITHM" default:"EdDSA" oneof:"HS256 RS256 EdDSA"`
+	JWTRotationInterval  time.Duration `env:"JWT_ROTATION_INTERVAL" default:"720h"`
+	AccessTokenDuration  time.Duration `env:"ACCESS_TOKEN_DURATION" default:"1h"`
+	RefreshTokenDuration time.Duration `env:"REFRESH_TOKEN_DURATION" default:"1440h"`
+
+	// Polka webhooks are authenticated with an HMAC signature by default.
+	// POLKA_WEBHOOK_SECRETS takes a comma separated list so secrets can be
+	// rotated; the legacy apikey mode compares POLKA_KEY instead, and stays
+	// the default for deployments that only set POLKA_KEY.
+	PolkaAuth               string        `env:"POLKA_AUTH" oneof:"signature apikey"`
+	PolkaWebhookSecrets     []string      `env:"POLKA_WEBHOOK_SECRETS" secret:"true"`
+	PolkaSignatureTolerance time.Duration `env:"POLKA_SIGNATURE_TOLERANCE" default:"5m"`
+	PolkaKey                string        `env:"POLKA_KEY" secret:"true"`
+
+	AdminKey string `env:"ADMIN_KEY" secret:"true"`
+
+	WebhookDeliveryTimeout time.Duration `env:"WEBHOOK_DELIVERY_TIMEOUT" default:"10s"`
+
+	ChirpMaxLength     int           `env:"CHIRP_MAX_LENGTH" default:"140"`
+	ChirpEditWindow    time.Duration `env:"CHIRP_EDIT_WINDOW" default:"15m"`
+	ChirpEditWindowRed time.Duration `env:"CHIRP_EDIT_WINDOW_RED" default:"1h"`
+	ProfanityFile      string        `env:"PROFANITY_FILE"`
+	UnverifiedPolicy   string        `env:"UNVERIFIED_POLICY" default:"no_chirps" oneof:"allow no_chirps read_only"`
+
+	Mailer       string `env:"MAILER" default:"log" oneof:"log file smtp"`
+	MailFrom     string `env:"MAIL_FROM" default:"Chirpy <no-reply@chirpy.local>"`
+	MailDir      string `env:"MAIL_DIR"`
+	SMTPAddr     string `env:"SMTP_ADDR"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true"`
+
+	LoginMaxAttempts   int           `env:"LOGIN_MAX_ATTEMPTS" default:"5"`
+	LoginMaxAttemptsIP int           `env:"LOGIN_MAX_ATTEMPTS_IP" default:"20"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" default:"1m"`
+	LoginLockoutMax    time.Duration `env:"LOGIN_LOCKOUT_MAX" default:"1h"`
+
+	RateLimits     string `env:"RATE_LIMITS"`
+	RateLimitStore string `env:"RATE_LIMIT_STORE" default:"memory" oneof:"memory postgres"`
+
+	LogLevel  string `env:"LOG_LEVEL" default:"info" oneof:"debug info warn error"`
+	LogFormat string `env:"LOG_FORMAT" default:"json" oneof:"json text"`
+
+	ShutdownDrain       time.Duration `env:"SHUTDOWN_DRAIN" default:"5s"`
+	ShutdownTimeout     time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	HealthMinDiskFreeMB int           `env:"HEALTH_MIN_DISK_FREE_MB" default:"100"`
+}
+
+// Load reads the configuration from the environment and the optional
+// config file. All problems are reported together.
+func Load(file string) (*Config, error) {
+	return load(file, os.LookupEnv)
+}
+
+func load(file string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	var fileValues map[string]string
+	if file != "" {
+		var err error
+		fileValues, err = readFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sources := []func(string) (string, bool){lookupEnv}
+	if fileValues != nil {
+		sources = append(sources, func(key string) (string, bool) {
+			value, ok := fileValues[key]
+			return value, ok
+		})
+	}
+
+	cfg := &Config{}
+	var errs []error
+	known := map[string]bool{}
+	v := reflect.ValueOf(cfg).Elem()
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		key := f.Tag.Get("env")
+		known[key] = true
+		known[key+"_FILE"] = true
+
+		raw, err := lookup(key, sources)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if raw == "" {
+			raw = f.Tag.Get("default")
+		}
+		if raw == "" {
+			if f.Tag.Get("required") == "true" {
+				errs = append(errs, fmt.Errorf("%s must be set", key))
+			}
+			continue
+		}
+		if oneof := f.Tag.Get("oneof"); oneof != "" && !slices.Contains(strings.Fields(oneof), raw) {
+			errs = append(errs, fmt.Errorf("%s must be one of %s, got %q", key, strings.Join(strings.Fields(oneof), ", "), raw))
+			continue
+		}
+		if err := set(v.FieldByIndex(f.Index), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", key, err))
+		}
+	}
+
+	errs = append(errs, cfg.validate()...)
+	for key := range fileValues {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", file, key))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// validate checks settings that depend on each other, after filling in
+// the defaults that depend on other settings.
+func (c *Config) validate() []error {
+	if c.PolkaAuth == "" {
+		c.PolkaAuth = "signature"
+		if len(c.PolkaWebhookSecrets) == 0 && c.PolkaKey != "" {
+			c.PolkaAuth = "apikey"
+		}
+	}
+
+	var errs []error
+	if c.JWTKeySource == "db" && c.JWTKeyEncryptionKey == "" {
+		errs = append(errs, errors.New("JWT_KEY_ENCRYPTION_KEY must be set when JWT_KEY_SOURCE=db"))
+	}
+	if c.Storage == "memory" {
+		if c.JWTKeySource == "db" {
+			errs = append(errs, errors.New("JWT_KEY_SOURCE=db needs STORAGE=postgres"))
+		}
+		if c.RateLimitStore == "postgres" {
+			errs = append(errs, errors.New("RATE_LIMIT_STORE=postgres needs STORAGE=postgres"))
+		}
+		// Polka webhooks aren't served without a database
+		return errs
+	}
+
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL must be set when STORAGE=postgres"))
+	}
+	switch c.PolkaAuth {
+	case "signature":
+		if len(c.PolkaWebhookSecrets) == 0 {
+			errs = append(errs, errors.New("POLKA_WEBHOOK_SECRETS must be set when POLKA_AUTH=signature"))
+		}
+	case "apikey":
+		if c.PolkaKey == "" {
+			errs = append(errs, errors.New("POLKA_KEY must be set when POLKA_AUTH=apikey"))
+		}
+	}
+	return errs
+}
+
+// lookup returns the first non-empty value for key, reading NAME_FILE
+// settings from disk.
+func lookup(key string, sources []func(string) (string, bool)) (string, error) {
+	for _, source := range sources {
+		if value, ok := source(key); ok && value != "" {
+			return value, nil
+		}
+		if path, ok := source(key + "_FILE"); ok && path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("%s_FILE: %w", key, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+	}
+	return "", nil
+}
+
+func set(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(raw)
+	case []string:
+		var values []string
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("must be a positive integer, got %q", raw)
+		}
+		field.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return fmt.Errorf("must be a duration like 30s or 1h, got %q", raw)
+		}
+		field.SetInt(int64(d))
+	default:
+		panic("config: unsupported field type " + field.Type().String())
+	}
+	return nil
+}
+
+// Print writes the effective configuration as NAME=value lines, in the
+// order of the fields, with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		field := v.FieldByIndex(f.Index)
+		value := fmt.Sprint(field.Interface())
+		if values, ok := field.Interface().([]string); ok {
+			value = strings.Join(values, ",")
+		}
+		if f.Tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.Tag.Get("env"), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
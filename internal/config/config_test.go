@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var required = map[string]string{
+	"PLATFORM":  "dev",
+	"DB_URL":    "postgres://localhost/chirpy",
+	"BEARER":    "secret",
+	"POLKA_KEY": "polka",
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load("", env(required))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "8080" || cfg.ChirpMaxLength != 140 || cfg.AccessTokenDuration != time.Hour {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.JWTSecret != "secret" {
+		t.Errorf("expected BEARER to be loaded, got %q", cfg.JWTSecret)
+	}
+}
+
+func TestPolkaAuthDefault(t *testing.T) {
+	// Deployments from before webhook signatures keep working
+	cfg, err := load("", env(required))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PolkaAuth != "apikey" {
+		t.Errorf("expected apikey with only POLKA_KEY set, got %q", cfg.PolkaAuth)
+	}
+
+	values := map[string]string{"POLKA_WEBHOOK_SECRETS": "whsec-old, whsec-new"}
+	for k, v := range required {
+		values[k] = v
+	}
+	cfg, err = load("", env(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PolkaAuth != "signature" {
+		t.Errorf("expected signature once secrets are set, got %q", cfg.PolkaAuth)
+	}
+	if len(cfg.PolkaWebhookSecrets) != 2 || cfg.PolkaWebhookSecrets[1] != "whsec-new" {
+		t.Errorf("unexpected webhook secrets %q", cfg.PolkaWebhookSecrets)
+	}
+
+	delete(values, "POLKA_KEY")
+	delete(values, "POLKA_WEBHOOK_SECRETS")
+	_, err = load("", env(values))
+	if err == nil || !strings.Contains(err.Error(), "POLKA_WEBHOOK_SECRETS must be set when POLKA_AUTH=signature") {
+		t.Errorf("expected POLKA_WEBHOOK_SECRETS error, got %v", err)
+	}
+}
+
+func TestPolkaAuthNeedsCredentials(t *testing.T) {
+	values := map[string]string{"POLKA_AUTH": "apikey"}
+	for k, v := range required {
+		values[k] = v
+	}
+	delete(values, "POLKA_KEY")
+	_, err := load("", env(values))
+	if err == nil || !strings.Contains(err.Error(), "POLKA_KEY must be set when POLKA_AUTH=apikey") {
+		t.Errorf("expected POLKA_KEY error, got %v", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	cfg, err := load("", env(map[string]string{
+		"PLATFORM": "dev",
+		"BEARER":   "secret",
+		"STORAGE":  "memory",
+	}))
+	if err != nil {
+		t.Fatalf("memory storage shouldn't need a database or Polka: %v", err)
+	}
+	if cfg.Storage != "memory" {
+		t.Errorf("expected memory storage, got %q", cfg.Storage)
+	}
+
+	_, err = load("", env(map[string]string{
+		"PLATFORM":         "dev",
+		"BEARER":           "secret",
+		"STORAGE":          "memory",
+		"RATE_LIMIT_STORE": "postgres",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_STORE=postgres needs STORAGE=postgres") {
+		t.Errorf("expected RATE_LIMIT_STORE error, got %v", err)
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	_, err := load("", env(map[string]string{
+		"LOGIN_MAX_ATTEMPTS": "zero",
+		"MAILER":             "pigeon",
+	}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"PLATFORM must be set", "DB_URL must be set", "LOGIN_MAX_ATTEMPTS", "MAILER must be one of"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	secretFile := writeFile(t, "polka_key", "from-file\n")
+	file := writeFile(t, "chirpy.toml", `
+# overridden by the environment
+port = 9000
+chirp_max_length = 280 # inline comment
+polka_key_file = "`+secretFile+`"
+mail_from = "Chirpy <hi@example.com>"
+`)
+
+	values := map[string]string{"PORT": "9100"}
+	for k, v := range required {
+		values[k] = v
+	}
+	delete(values, "POLKA_KEY")
+
+	cfg, err := load(file, env(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "9100" {
+		t.Errorf("environment should win over the file, got port %q", cfg.Port)
+	}
+	if cfg.ChirpMaxLength != 280 {
+		t.Errorf("expected chirp length from file, got %d", cfg.ChirpMaxLength)
+	}
+	if cfg.PolkaKey != "from-file" {
+		t.Errorf("expected secret from file, got %q", cfg.PolkaKey)
+	}
+	if cfg.MailFrom != "Chirpy <hi@example.com>" {
+		t.Errorf("unexpected MAIL_FROM %q", cfg.MailFrom)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	file := writeFile(t, "chirpy.yaml", "---\nPLATFORM: prod\nshutdown_drain: '10s'\nunknown_thing: 1\n")
+	_, err := load(file, env(required))
+	if err == nil || !strings.Contains(err.Error(), `unknown setting "UNKNOWN_THING"`) {
+		t.Fatalf("expected unknown setting error, got %v", err)
+	}
+
+	file = writeFile(t, "chirpy.yaml", "---\nPLATFORM: prod\nshutdown_drain: '10s'\n")
+	cfg, err := load(file, env(map[string]string{"DB_URL": "x", "BEARER": "x", "POLKA_KEY": "x"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Platform != "prod" || cfg.ShutdownDrain != 10*time.Second {
+		t.Errorf("unexpected values from YAML: %q %s", cfg.Platform, cfg.ShutdownDrain)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, err := load("", env(required))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "postgres://") || strings.Contains(out.String(), "polka") {
+		t.Errorf("secrets leaked:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "BEARER=[redacted]\n") || !strings.Contains(out.String(), "PORT=8080\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "ADMIN_KEY=\n") {
+		t.Errorf("unset secrets should print empty:\n%s", out.String())
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile reads a flat config file. TOML files use "key = value" and YAML
+// files "key: value", one setting per line with # comments. Keys are the
+// environment variable names in either case, e.g. db_url or DB_URL. Tables
+// and nested keys are not supported.
+func readFile(path string) (map[string]string, error) {
+	var sep string
+	switch ext := filepath.Ext(path); ext {
+	case ".toml":
+		sep = "="
+	case ".yaml", ".yml":
+		sep = ":"
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, use .toml or .yaml", path, ext)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") || strings.HasPrefix(scanner.Text(), " ") || strings.HasPrefix(scanner.Text(), "\t") {
+			return nil, fmt.Errorf("%s:%d: nested settings are not supported", path, line)
+		}
+
+		key, raw, ok := strings.Cut(text, sep)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key %s value", path, line, sep)
+		}
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		values[strings.ToUpper(strings.TrimSpace(key))] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// parseValue unquotes strings and strips trailing comments from bare values.
+func parseValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		end := closingQuote(raw)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return strconv.Unquote(raw[:end+1])
+	case strings.HasPrefix(raw, "'"):
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return raw[1 : end+1], nil
+	default:
+		value, _, _ := strings.Cut(raw, "#")
+		return strings.TrimSpace(value), nil
+	}
+}
+
+// closingQuote finds the quote ending a double quoted string, skipping
+// escaped quotes.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -6,33 +6,192 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	BodyTsv    interface{}
+	InReplyTo  uuid.NullUUID
+	ReplyCount int32
+	DeletedAt  sql.NullTime
+	LikeCount  int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type JwtKey struct {
+	Kid        string
+	Algorithm  string
+	PrivateKey string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	Generation int64
+}
+
+type Like struct {
 	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type LoginFailure struct {
+	Scope          string
+	Key            string
+	Failures       int32
+	FirstFailureAt time.Time
+	LastFailureAt  time.Time
+	LockedUntil    sql.NullTime
+}
+
+type ModerationFlag struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Terms      []string
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type ProfanityTerm struct {
+	Term      string
+	Policy    string
 	CreatedAt time.Time
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
 	UpdatedAt time.Time
+}
+
+type RecoveryCode struct {
 	UserID    uuid.UUID
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	Token       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	ExpiresAt   time.Time
+	RevokedAt   sql.NullTime
+	FamilyID    uuid.UUID
+	ReplacedBy  sql.NullString
+	UserAgent   string
+	IpAddress   string
+	DeviceLabel string
+}
+
+type Subscription struct {
+	UserID      uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Status      string
+	Plan        string
+	PeriodEnd   sql.NullTime
+	LastEventAt sql.NullTime
+}
+
+type SubscriptionEvent struct {
+	ID         uuid.UUID
+	ReceivedAt time.Time
+	UserID     uuid.NullUUID
+	Event      string
+	Status     sql.NullString
+	Payload    json.RawMessage
 }
 
 type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	TotpSecret      sql.NullString
+	TotpEnabled     bool
+	TotpLastStep    int64
+	EmailVerifiedAt sql.NullTime
+	PendingEmail    sql.NullString
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	NextAttemptAt  time.Time
+	LockedUntil    sql.NullTime
+	DeliveredAt    sql.NullTime
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WebhookInbox struct {
+	ID            uuid.UUID
+	Source        string
+	EventID       string
+	EventType     string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int32
+	LastError     sql.NullString
+	ReceivedAt    time.Time
+	NextAttemptAt time.Time
+	LockedUntil   sql.NullTime
+	ProcessedAt   sql.NullTime
 }
@@ -0,0 +1,238 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const Mask = "****"
+
+type Policy string
+
+const (
+	PolicyMask     Policy = "mask"
+	PolicyReject   Policy = "reject"
+	PolicyModerate Policy = "moderate"
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PolicyMask, nil
+	case PolicyMask, PolicyReject, PolicyModerate:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown policy %q", s)
+	}
+}
+
+type Term struct {
+	Word   string
+	Policy Policy
+}
+
+// Result describes what the filter did to a body.
+type Result struct {
+	Body     string
+	Rejected bool
+	Moderate bool
+	Matches  []string
+}
+
+// Filter matches words against a mutable term list. It is safe for
+// concurrent use.
+type Filter struct {
+	mu    sync.RWMutex
+	terms map[string]Policy
+}
+
+func New(terms []Term) *Filter {
+	f := &Filter{}
+	f.Replace(terms)
+	return f
+}
+
+// Replace swaps the whole term list.
+func (f *Filter) Replace(terms []Term) {
+	m := make(map[string]Policy, len(terms))
+	for _, t := range terms {
+		if w := Normalize(t.Word); w != "" {
+			m[w] = t.Policy
+		}
+	}
+	f.mu.Lock()
+	f.terms = m
+	f.mu.Unlock()
+}
+
+func (f *Filter) Set(word string, policy Policy) {
+	w := Normalize(word)
+	if w == "" {
+		return
+	}
+	f.mu.Lock()
+	f.terms[w] = policy
+	f.mu.Unlock()
+}
+
+// Remove deletes a term and reports whether it was present.
+func (f *Filter) Remove(word string) bool {
+	w := Normalize(word)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.terms[w]
+	delete(f.terms, w)
+	return ok
+}
+
+func (f *Filter) Terms() []Term {
+	f.mu.RLock()
+	terms := make([]Term, 0, len(f.terms))
+	for w, p := range f.terms {
+		terms = append(terms, Term{Word: w, Policy: p})
+	}
+	f.mu.RUnlock()
+	sort.Slice(terms, func(i, j int) bool { return terms[i].Word < terms[j].Word })
+	return terms
+}
+
+// Check scans body word by word. Words matching a mask term are replaced
+// with Mask, keeping surrounding punctuation and the original whitespace.
+func (f *Filter) Check(body string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	res := Result{}
+	var b strings.Builder
+	for _, tok := range tokenize(body) {
+		if tok.space {
+			b.WriteString(tok.text)
+			continue
+		}
+		prefix, core, suffix := splitPunct(tok.text)
+		policy, ok := f.terms[Normalize(core)]
+		if !ok {
+			b.WriteString(tok.text)
+			continue
+		}
+		res.Matches = append(res.Matches, core)
+		switch policy {
+		case PolicyReject:
+			res.Rejected = true
+			b.WriteString(tok.text)
+		case PolicyModerate:
+			res.Moderate = true
+			b.WriteString(tok.text)
+		default:
+			b.WriteString(prefix + Mask + suffix)
+		}
+	}
+	res.Body = b.String()
+	return res
+}
+
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'@': 'a',
+	'$': 's',
+}
+
+var folder = cases.Fold()
+
+// Normalize reduces a word to the form terms are compared in: NFKC, Unicode
+// case folding, leetspeak substitution and with everything but letters and
+// digits removed.
+func Normalize(word string) string {
+	word = folder.String(norm.NFKC.String(word))
+	var b strings.Builder
+	for _, r := range word {
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type token struct {
+	text  string
+	space bool
+}
+
+func tokenize(s string) []token {
+	var toks []token
+	start := 0
+	space := false
+	for i, r := range s {
+		isSpace := unicode.IsSpace(r)
+		if i > start && isSpace != space {
+			toks = append(toks, token{text: s[start:i], space: space})
+			start = i
+		}
+		space = isSpace
+	}
+	if start < len(s) {
+		toks = append(toks, token{text: s[start:], space: space})
+	}
+	return toks
+}
+
+// splitPunct separates leading and trailing punctuation from a word so it
+// survives masking. Characters that double as leetspeak are kept in the core.
+func splitPunct(word string) (prefix, core, suffix string) {
+	isEdge := func(r rune) bool {
+		_, isLeet := leet[r]
+		return !isLeet && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	core = strings.TrimLeftFunc(word, isEdge)
+	prefix = word[:len(word)-len(core)]
+	trimmed := strings.TrimRightFunc(core, isEdge)
+	suffix = core[len(trimmed):]
+	return prefix, trimmed, suffix
+}
+
+// LoadFile reads a term list with one term per line, optionally followed
+// by a comma and a policy. Blank lines and lines starting with # are skipped.
+func LoadFile(path string) ([]Term, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var terms []Term
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		word, policyText, _ := strings.Cut(text, ",")
+		policy, err := ParsePolicy(policyText)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		terms = append(terms, Term{Word: strings.TrimSpace(word), Policy: policy})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
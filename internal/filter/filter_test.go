@@ -0,0 +1,91 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckMasksDefaultWords(t *testing.T) {
+	f := New([]Term{
+		{Word: "kerfuffle", Policy: PolicyMask},
+		{Word: "sharbert", Policy: PolicyMask},
+		{Word: "fornax", Policy: PolicyMask},
+	})
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"This is a kerfuffle opinion I need to share with the world", "This is a **** opinion I need to share with the world"},
+		{"I hear Mastodon is better than Chirpy. sharbert I need to migrate", "I hear Mastodon is better than Chirpy. **** I need to migrate"},
+		{"I really need a kerfuffle to go to bed sooner, Fornax !", "I really need a **** to go to bed sooner, **** !"},
+		{"what a kerfuffle!", "what a ****!"},
+		{"K3RFUFFLE  everywhere", "****  everywhere"},
+		{"ＦＯＲＮＡＸ", "****"},
+		{"nothing to see here", "nothing to see here"},
+	}
+
+	for _, tt := range tests {
+		got := f.Check(tt.body)
+		if got.Body != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.body, got.Body, tt.want)
+		}
+		if got.Rejected || got.Moderate {
+			t.Errorf("Check(%q) unexpectedly rejected or flagged", tt.body)
+		}
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	f := New([]Term{
+		{Word: "banned", Policy: PolicyReject},
+		{Word: "suspicious", Policy: PolicyModerate},
+	})
+
+	res := f.Check("a BANNED word")
+	if !res.Rejected {
+		t.Error("expected chirp to be rejected")
+	}
+
+	res = f.Check("a suspicious word")
+	if !res.Moderate || res.Rejected {
+		t.Errorf("expected chirp to be flagged for moderation, got %+v", res)
+	}
+	if res.Body != "a suspicious word" {
+		t.Errorf("moderated body should be unchanged, got %q", res.Body)
+	}
+}
+
+func TestSetAndRemove(t *testing.T) {
+	f := New(nil)
+	f.Set("Straße", PolicyMask)
+
+	if got := f.Check("STRASSE").Body; got != Mask {
+		t.Errorf("expected case-folded match, got %q", got)
+	}
+
+	f.Remove("strasse")
+	if got := f.Check("strasse").Body; got != "strasse" {
+		t.Errorf("expected term to be removed, got %q", got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terms.txt")
+	content := "# comment\nkerfuffle\n\nbanned, reject\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	terms, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if len(terms) != 2 {
+		t.Fatalf("expected 2 terms, got %d", len(terms))
+	}
+	if terms[0].Policy != PolicyMask || terms[1].Policy != PolicyReject {
+		t.Errorf("unexpected policies: %+v", terms)
+	}
+}
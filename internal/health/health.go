@@ -0,0 +1,161 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Check reports a problem with a dependency by returning an error.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the checks behind the liveness and readiness endpoints.
+// Liveness checks should only fail when restarting the process would help;
+// readiness checks decide whether the instance gets traffic.
+type Registry struct {
+	// Timeout bounds each check. Zero means two seconds.
+	Timeout time.Duration
+	// ShowErrors decides who may see check errors with ?verbose. When nil
+	// errors are never shown.
+	ShowErrors func(r *http.Request) bool
+
+	mu    sync.RWMutex
+	live  []namedCheck
+	ready []namedCheck
+}
+
+func (reg *Registry) AddLiveness(name string, check Check) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.live = append(reg.live, namedCheck{name, check})
+}
+
+func (reg *Registry) AddReadiness(name string, check Check) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.ready = append(reg.ready, namedCheck{name, check})
+}
+
+// CheckResult is the outcome of one check. Error is only shown in verbose
+// mode, to requests ShowErrors allows, since it can reveal details about
+// the infrastructure.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+func (reg *Registry) LivenessHandler() http.Handler {
+	return reg.handler(func() []namedCheck { return reg.live })
+}
+
+func (reg *Registry) ReadinessHandler() http.Handler {
+	return reg.handler(func() []namedCheck { return reg.ready })
+}
+
+func (reg *Registry) handler(checks func() []namedCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.mu.RLock()
+		list := checks()
+		reg.mu.RUnlock()
+
+		report := reg.run(r.Context(), list)
+		if !r.URL.Query().Has("verbose") || reg.ShowErrors == nil || !reg.ShowErrors(r) {
+			for name, res := range report.Checks {
+				res.Error = ""
+				report.Checks[name] = res
+			}
+		}
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// run executes the checks concurrently so one slow dependency doesn't
+// add to the latency of the others.
+func (reg *Registry) run(ctx context.Context, checks []namedCheck) Report {
+	timeout := reg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			res := CheckResult{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = res
+			if err != nil {
+				report.Status = StatusFail
+			}
+		})
+	}
+	wg.Wait()
+	return report
+}
+
+// Ping checks that the database accepts connections.
+func Ping(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// DiskSpace checks that the filesystem holding path has at least minFree
+// bytes available.
+func DiskSpace(path string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free on %s, want at least %d", free, path, minFree)
+		}
+		return nil
+	}
+}
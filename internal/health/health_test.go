@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, h http.Handler, target string) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("couldn't decode report: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	reg := &Registry{}
+	reg.AddReadiness("ok", func(ctx context.Context) error { return nil })
+	reg.AddReadiness("broken", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	code, report := serve(t, reg.ReadinessHandler(), "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", code)
+	}
+	if report.Status != StatusFail {
+		t.Errorf("expected status fail, got %q", report.Status)
+	}
+	if report.Checks["ok"].Status != StatusOK || report.Checks["broken"].Status != StatusFail {
+		t.Errorf("unexpected check results: %+v", report.Checks)
+	}
+	if report.Checks["broken"].Error != "" {
+		t.Errorf("error shown without verbose: %q", report.Checks["broken"].Error)
+	}
+
+	_, report = serve(t, reg.ReadinessHandler(), "/readyz?verbose")
+	if report.Checks["broken"].Error != "" {
+		t.Errorf("error shown without ShowErrors: %q", report.Checks["broken"].Error)
+	}
+
+	reg.ShowErrors = func(r *http.Request) bool { return r.Header.Get("Authorization") == "ApiKey admin" }
+	_, report = serve(t, reg.ReadinessHandler(), "/readyz?verbose")
+	if report.Checks["broken"].Error != "" {
+		t.Errorf("error shown to a request ShowErrors refused: %q", report.Checks["broken"].Error)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz?verbose", nil)
+	req.Header.Set("Authorization", "ApiKey admin")
+	rec := httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(rec, req)
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checks["broken"].Error != "connection refused" {
+		t.Errorf("expected error in verbose mode, got %q", report.Checks["broken"].Error)
+	}
+}
+
+func TestLivenessIgnoresReadiness(t *testing.T) {
+	reg := &Registry{}
+	reg.AddReadiness("broken", func(ctx context.Context) error { return errors.New("down") })
+
+	code, report := serve(t, reg.LivenessHandler(), "/livez")
+	if code != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("expected healthy liveness, got %d %q", code, report.Status)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	reg := &Registry{Timeout: 10 * time.Millisecond}
+	reg.AddReadiness("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, _ := serve(t, reg.ReadinessHandler(), "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for timed out check, got %d", code)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpace(dir, 1)(context.Background()); err != nil {
+		t.Errorf("expected some free space: %v", err)
+	}
+	if err := DiskSpace(dir, 1<<62)(context.Background()); err == nil {
+		t.Error("expected failure for an impossible minimum")
+	}
+}
@@ -0,0 +1,178 @@
+// Package logging sets up structured logging and the per-request access
+// log.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// New returns a logger writing text or JSON at the given level, one of
+// debug, info, warn or error.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+type ctxKey struct{}
+
+type requestInfo struct {
+	id     string
+	logger *slog.Logger
+}
+
+// FromContext returns the request's logger, tagged with its request ID,
+// or the default logger outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+		return info.logger
+	}
+	return slog.Default()
+}
+
+// RequestID returns the ID Middleware assigned to the request, if any.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// Middleware assigns each request an ID, or keeps the one the client sent
+// in X-Request-ID, and writes an access log line when it finishes.
+type Middleware struct {
+	Logger *slog.Logger
+	// UserID optionally identifies the user behind a request for the
+	// access log. It runs after the handler.
+	UserID func(r *http.Request) string
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := m.Logger.With("request_id", id)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, &requestInfo{id: id, logger: logger}))
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", r.Pattern,
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+			"client_ip", clientip.FromRequest(r),
+		}
+		if m.UserID != nil {
+			if userID := m.UserID(r); userID != "" {
+				attrs = append(attrs, "user_id", userID)
+			}
+		}
+		if rw.errMsg != "" {
+			attrs = append(attrs, "error_message", rw.errMsg)
+		}
+		if rw.err != nil {
+			attrs = append(attrs, "error", rw.err.Error())
+		}
+
+		level := slog.LevelInfo
+		if rw.status >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// RecordError attaches the error behind a response to the request's access
+// log line. It is a no-op for writers that didn't come from Middleware, so
+// it reports whether the error was recorded.
+func RecordError(w http.ResponseWriter, msg string, err error) bool {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			rw.errMsg = msg
+			rw.err = err
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+	errMsg      string
+	err         error
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return strings.IndexFunc(id, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+	}) < 0
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		if RequestID(r.Context()) == "" {
+			t.Error("request ID missing from context")
+		}
+		RecordError(w, "Database error", errors.New("connection reset"))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("oops"))
+	})
+	m := &Middleware{
+		Logger: logger,
+		UserID: func(r *http.Request) string { return "user-1" },
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/123", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	m.Handler(mux).ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("expected request ID to be propagated, got %q", got)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("access log isn't JSON: %v\n%s", err, buf.String())
+	}
+	want := map[string]any{
+		"level":         "ERROR",
+		"request_id":    "abc-123",
+		"route":         "GET /api/chirps/{chirpID}",
+		"status":        float64(500),
+		"bytes":         float64(4),
+		"user_id":       "user-1",
+		"error_message": "Database error",
+		"error":         "connection reset",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	logger, _ := New(&bytes.Buffer{}, "info", "text")
+	m := &Middleware{Logger: logger}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	rec := httptest.NewRecorder()
+	m.Handler(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	got := rec.Header().Get(RequestIDHeader)
+	if got == "" || got == req.Header.Get(RequestIDHeader) {
+		t.Errorf("expected a fresh request ID, got %q", got)
+	}
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", "json"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
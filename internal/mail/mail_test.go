@@ -0,0 +1,159 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Hello\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 message file, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+
+	if !strings.Contains(content, "To: user@example.com\r\n") {
+		t.Errorf("missing To header:\n%s", content)
+	}
+	if strings.Contains(content, "\r\nBcc:") {
+		t.Errorf("header injection was not prevented:\n%s", content)
+	}
+	if !strings.HasSuffix(content, "line one\r\nline two") {
+		t.Errorf("unexpected body:\n%s", content)
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		valid bool
+	}{
+		{"walt@breakingbad.com", "walt@breakingbad.com", true},
+		{"  saul@bettercall.com ", "saul@bettercall.com", true},
+		{"Jesse@BreakingBad.com", "jesse@breakingbad.com", true},
+		{"not-an-email", "", false},
+		{"Walt <walt@breakingbad.com>", "", false},
+		{"walt@localhost", "", false},
+		{"walt@breakingbad.", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeAddress(tt.in)
+		if (err == nil) != tt.valid {
+			t.Errorf("NormalizeAddress(%q) error = %v, want valid %v", tt.in, err, tt.valid)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeAddress(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// fakeSMTP accepts one connection on a local port and hands it to serve.
+func fakeSMTP(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestSMTPMailer(t *testing.T) {
+	received := make(chan string, 1)
+	addr := fakeSMTP(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case inData && line == ".\r\n":
+				inData = false
+				received <- data.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case inData:
+				data.WriteString(line)
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(conn, "250 fake\r\n")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				fmt.Fprint(conn, "354 go ahead\r\n")
+			case strings.HasPrefix(line, "QUIT"):
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	})
+
+	m := &SMTPMailer{Addr: addr, From: "Chirpy <chirpy@example.com>"}
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "hello"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got := <-received; !strings.Contains(got, "To: user@example.com\r\n") {
+		t.Errorf("unexpected message:\n%s", got)
+	}
+}
+
+func TestSMTPMailerHonoursContext(t *testing.T) {
+	// Greets, then never answers
+	addr := fakeSMTP(t, func(conn net.Conn) {
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		io.Copy(io.Discard, conn)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	m := &SMTPMailer{Addr: addr, From: "chirpy@example.com"}
+	err := m.Send(ctx, Message{To: "user@example.com", Subject: "Hi", Body: "hello"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v after the deadline", elapsed)
+	}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// DBTX matches the interface sqlc generates for database.New.
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// DB records how long each query takes, labelled with the name sqlc puts
+// in the "-- name: GetUserByID :one" comment at the top of the query.
+type DB struct {
+	db       DBTX
+	duration *HistogramVec
+}
+
+func InstrumentDB(reg *Registry, db DBTX) *DB {
+	return &DB{
+		db: db,
+		duration: reg.NewHistogramVec("db_query_duration_seconds",
+			"Database query latency by sqlc query name.", DefBuckets, "query", "status"),
+	}
+}
+
+func (d *DB) observe(query string, start time.Time, err error) {
+	status := "ok"
+	if err != nil && err != sql.ErrNoRows {
+		status = "error"
+	}
+	d.duration.With(queryName(query), status).Observe(time.Since(start).Seconds())
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := d.db.ExecContext(ctx, query, args...)
+	d.observe(query, start, err)
+	return res, err
+}
+
+func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.db.PrepareContext(ctx, query)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	d.observe(query, start, err)
+	return rows, err
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := d.db.QueryRowContext(ctx, query, args...)
+	d.observe(query, start, row.Err())
+	return row
+}
+
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+// RegisterDBStats exposes the connection pool stats of db.
+func RegisterDBStats(reg *Registry, db *sql.DB) {
+	reg.NewGaugeFunc("db_open_connections", "Open database connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	reg.NewGaugeFunc("db_in_use_connections", "Database connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	reg.NewGaugeFunc("db_idle_connections", "Idle database connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	reg.NewGaugeFunc("db_max_open_connections", "Maximum number of open database connections.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	reg.NewCounterFunc("db_wait_count_total", "Times a query waited for a free connection.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	reg.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for a free connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// InstrumentHandler counts requests and records their latency by route
+// pattern, so paths with IDs in them don't each get their own series.
+// Requests that match no route are reported as "unmatched".
+func InstrumentHandler(reg *Registry, next http.Handler) http.Handler {
+	requests := reg.NewCounterVec("http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "status")
+	duration := reg.NewHistogramVec("http_request_duration_seconds",
+		"HTTP request latency by method and route pattern.", DefBuckets, "method", "route")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		requests.With(r.Method, route, strconv.Itoa(sw.status)).Inc()
+		duration.With(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.status = code
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
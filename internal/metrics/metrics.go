@@ -0,0 +1,351 @@
+// Package metrics keeps counters, gauges and histograms and serves them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets suit request and query latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in the order they should be exposed.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, existing := range reg.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: duplicate metric " + c.name())
+		}
+	}
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Write writes every metric in the text exposition format.
+func (reg *Registry) Write(w io.Writer) error {
+	reg.mu.Lock()
+	collectors := slices.Clone(reg.collectors)
+	reg.mu.Unlock()
+	slices.SortFunc(collectors, func(a, b collector) int {
+		return strings.Compare(a.name(), b.name())
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Write(w)
+	})
+}
+
+// value is a float64 that can be updated concurrently.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if v.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (v *value) load() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+// family holds the series of one metric, keyed by label values.
+type family[T any] struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	newSeries  func() *T
+
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newFamily[T any](name, help, kind string, labels []string, newSeries func() *T) *family[T] {
+	return &family[T]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		newSeries:  newSeries,
+		series:     map[string]*T{},
+		values:     map[string][]string{},
+	}
+}
+
+func (f *family[T]) name() string { return f.metricName }
+
+func (f *family[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = f.newSeries()
+	f.series[key] = s
+	f.values[key] = slices.Clone(labelValues)
+	return s
+}
+
+func (f *family[T]) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.series = map[string]*T{}
+	f.values = map[string][]string{}
+}
+
+// each calls fn for every series in a stable order.
+func (f *family[T]) each(fn func(labelValues []string, s *T)) {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	series := make([]*T, len(keys))
+	values := make([][]string, len(keys))
+	for i, k := range keys {
+		series[i] = f.series[k]
+		values[i] = f.values[k]
+	}
+	f.mu.RUnlock()
+
+	for i := range keys {
+		fn(values[i], series[i])
+	}
+}
+
+func (f *family[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.kind)
+}
+
+// Counter only goes up, except when reset.
+type Counter struct {
+	v value
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters can't decrease")
+	}
+	c.v.add(delta)
+}
+
+func (c *Counter) Value() float64 {
+	return c.v.load()
+}
+
+type CounterVec struct {
+	f *family[Counter]
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{f: newFamily(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	reg.register(cv)
+	return cv
+}
+
+// NewCounter registers a counter without labels.
+func (reg *Registry) NewCounter(name, help string) *Counter {
+	return reg.NewCounterVec(name, help).With()
+}
+
+// With returns the counter for the label values, in the order the labels
+// were declared.
+func (cv *CounterVec) With(labelValues ...string) *Counter {
+	return cv.f.with(labelValues)
+}
+
+// Reset drops every series.
+func (cv *CounterVec) Reset() {
+	cv.f.reset()
+}
+
+func (cv *CounterVec) name() string { return cv.f.name() }
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	cv.f.writeHeader(w)
+	cv.f.each(func(labelValues []string, c *Counter) {
+		writeSample(w, cv.f.metricName, cv.f.labels, labelValues, "", "", c.Value())
+	})
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64
+	count       atomic.Uint64
+	sum         value
+}
+
+func (h *Histogram) Observe(v float64) {
+	if i, _ := slices.BinarySearch(h.upperBounds, v); i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.add(v)
+}
+
+type HistogramVec struct {
+	f       *family[Histogram]
+	buckets []float64
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	hv := &HistogramVec{
+		buckets: buckets,
+		f: newFamily(name, help, "histogram", labels, func() *Histogram {
+			return &Histogram{upperBounds: buckets, counts: make([]atomic.Uint64, len(buckets))}
+		}),
+	}
+	reg.register(hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(labelValues ...string) *Histogram {
+	return hv.f.with(labelValues)
+}
+
+func (hv *HistogramVec) name() string { return hv.f.name() }
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	hv.f.writeHeader(w)
+	hv.f.each(func(labelValues []string, h *Histogram) {
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += h.counts[i].Load()
+			writeSample(w, hv.f.metricName+"_bucket", hv.f.labels, labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		count := float64(h.count.Load())
+		writeSample(w, hv.f.metricName+"_bucket", hv.f.labels, labelValues, "le", "+Inf", count)
+		writeSample(w, hv.f.metricName+"_sum", hv.f.labels, labelValues, "", "", h.sum.load())
+		writeSample(w, hv.f.metricName+"_count", hv.f.labels, labelValues, "", "", count)
+	})
+}
+
+// funcMetric reads its value when scraped, for stats kept elsewhere.
+type funcMetric struct {
+	metricName string
+	help       string
+	kind       string
+	fn         func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every
+// scrape.
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(&funcMetric{metricName: name, help: help, kind: "gauge", fn: fn})
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only go up.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(&funcMetric{metricName: name, help: help, kind: "counter", fn: fn})
+}
+
+func (m *funcMetric) name() string { return m.metricName }
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", m.metricName, escapeHelp(m.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.metricName, m.kind)
+	writeSample(w, m.metricName, nil, nil, "", "", m.fn())
+}
+
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, reg *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := reg.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	logins := reg.NewCounterVec("logins_total", "Logins by result.", "result")
+	logins.With("success").Add(2)
+	logins.With(`we"ird`).Inc()
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(0.5)
+	latency.With("/a").Observe(3)
+	reg.NewGaugeFunc("pool_open", "Open connections.", func() float64 { return 4 })
+
+	got := render(t, reg)
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 3.55
+latency_seconds_count{route="/a"} 3
+# HELP logins_total Logins by result.
+# TYPE logins_total counter
+logins_total{result="success"} 2
+logins_total{result="we\"ird"} 1
+# HELP pool_open Open connections.
+# TYPE pool_open gauge
+pool_open 4
+`
+	if got != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterReset(t *testing.T) {
+	reg := NewRegistry()
+	hits := reg.NewCounterVec("hits_total", "Hits.")
+	hits.With().Add(5)
+	hits.Reset()
+	if v := hits.With().Value(); v != 0 {
+		t.Errorf("expected 0 after reset, got %v", v)
+	}
+}
+
+func TestInstrumentHandler(t *testing.T) {
+	reg := NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	h := InstrumentHandler(reg, mux)
+
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := render(t, reg)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="GET /api/chirps/{chirpID}",status="404"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="GET /api/chirps/{chirpID}"} 2`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	if got := queryName("-- name: GetUserByID :one\nSELECT 1"); got != "GetUserByID" {
+		t.Errorf("got %q", got)
+	}
+	if got := queryName("SELECT 1"); got != "other" {
+		t.Errorf("got %q", got)
+	}
+}
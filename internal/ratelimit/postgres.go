@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// instance sharing the database enforces the same limits. Each Take is a
+// single upsert, so concurrent requests can't both spend the last token.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: limit.burst(),
+		Rate:  limit.rate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, row.Tokens, row.Allowed), nil
+}
+
+// Prune deletes buckets untouched for longer than idle until ctx is done.
+// idle should be at least the longest limit period, so pruned buckets
+// would have been full again anyway.
+func (s *PostgresStore) Prune(ctx context.Context, idle time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.db.DeleteIdleRateLimitBuckets(ctx, time.Now().Add(-idle)); err != nil {
+			slog.Error("Couldn't prune rate limit buckets", "error", err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
+)
+
+// Limit allows Requests per Per, with bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) burst() float64 {
+	return float64(l.Requests)
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// ParseLimit reads limits like "30/1m" or "10/1h".
+func ParseLimit(s string) (Limit, error) {
+	n, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like 30/1m", s)
+	}
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive request count", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive duration", s)
+	}
+	return Limit{Requests: requests, Per: d}, nil
+}
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed    bool
+	Limit      Limit
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((limit.burst() - tokens) / limit.rate()),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+// Store holds token buckets. Take refills the bucket for key and removes a
+// token if one is available.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// KeyFunc picks the bucket a request draws from. Tier selects one of the
+// policy's Tiers; an empty tier uses the default limit.
+type KeyFunc func(r *http.Request) (key, tier string)
+
+type Policy struct {
+	Limit Limit
+	Tiers map[string]Limit
+	Key   KeyFunc
+}
+
+// Middleware applies the policy registered for the route pattern a request
+// matches. Requests to routes without a policy pass straight through.
+type Middleware struct {
+	Store    Store
+	Policies map[string]Policy
+	// Pattern returns the route pattern for a request, e.g. from
+	// http.ServeMux.Handler.
+	Pattern func(r *http.Request) string
+	// OnLimited writes the 429 response. Headers are already set.
+	OnLimited func(w http.ResponseWriter, r *http.Request)
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern := m.Pattern(r)
+		// Limited requests never reach the mux, so record the route here
+		// for the access log and metrics further out
+		r.Pattern = pattern
+		policy, ok := m.Policies[pattern]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, tier := policy.Key(r)
+		limit := policy.Limit
+		if l, ok := policy.Tiers[tier]; ok {
+			limit = l
+		}
+
+		res, err := m.Store.Take(r.Context(), pattern+"|"+key, limit)
+		if err != nil {
+			// Rather serve without limits than not at all
+			slog.ErrorContext(r.Context(), "Rate limit store failed", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Per.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Seconds())))
+		if res.Allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+		if m.OnLimited != nil {
+			m.OnLimited(w, r)
+			return
+		}
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Too many requests"})
+	})
+}
+
+// ByIP keys requests by client IP, as resolved through trusted proxies by
+// clientip.Middleware.
+func ByIP(r *http.Request) (key, tier string) {
+	return "ip:" + clientip.FromRequest(r), ""
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("30/1m")
+	if err != nil {
+		t.Fatalf("ParseLimit failed: %v", err)
+	}
+	if l.Requests != 30 || l.Per != time.Minute {
+		t.Errorf("unexpected limit %+v", l)
+	}
+
+	for _, bad := range []string{"", "30", "0/1m", "30/0s", "x/1m"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Per: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		res, _ := s.Take(context.Background(), "k", limit)
+		if !res.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+
+	res, _ := s.Take(context.Background(), "k", limit)
+	if res.Allowed {
+		t.Fatal("third request should be limited")
+	}
+	if res.RetryAfter != 30*time.Second {
+		t.Errorf("expected retry after 30s, got %s", res.RetryAfter)
+	}
+
+	now = now.Add(30 * time.Second)
+	res, _ = s.Take(context.Background(), "k", limit)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expected one token after refill, got %+v", res)
+	}
+
+	other, _ := s.Take(context.Background(), "other", limit)
+	if !other.Allowed || other.Remaining != 1 {
+		t.Errorf("buckets should be independent, got %+v", other)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := &Middleware{
+		Store: NewMemoryStore(),
+		Policies: map[string]Policy{
+			"POST /limited": {
+				Limit: Limit{Requests: 1, Per: time.Hour},
+				Tiers: map[string]Limit{"red": {Requests: 2, Per: time.Hour}},
+				Key: func(r *http.Request) (string, string) {
+					return r.Header.Get("X-User"), r.Header.Get("X-Tier")
+				},
+			},
+		},
+		Pattern: func(r *http.Request) string { return r.Method + " " + r.URL.Path },
+	}
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	var last *http.Request
+	do := func(path, user, tier string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-User", user)
+		req.Header.Set("X-Tier", tier)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		last = req
+		return rec
+	}
+
+	if rec := do("/limited", "a", ""); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first request: %d %v", rec.Code, rec.Header())
+	}
+	rec := do("/limited", "a", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("expected Retry-After 3600, got %q", rec.Header().Get("Retry-After"))
+	}
+	if last.Pattern != "POST /limited" {
+		t.Errorf("limited request should carry its route, got %q", last.Pattern)
+	}
+
+	if rec := do("/limited", "b", "red"); rec.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("expected red tier limit, got %v", rec.Header())
+	}
+	if rec := do("/open", "a", ""); rec.Code != http.StatusNoContent || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("routes without a policy should not be limited")
+	}
+}
+
+func TestByIPBehindProxy(t *testing.T) {
+	ips, err := clientip.NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	h := ips.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := ByIP(r)
+		keys = append(keys, key)
+	}))
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		r := httptest.NewRequest(http.MethodPost, "/api/users", nil)
+		r.RemoteAddr = "10.0.0.1:5000"
+		r.Header.Set("X-Forwarded-For", client)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if keys[0] != "ip:198.51.100.1" || keys[1] != "ip:198.51.100.2" {
+		t.Errorf("clients behind the same proxy got keys %q", keys)
+	}
+}
@@ -0,0 +1,622 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+var errDuplicateKey = errors.New("storage: duplicate key")
+
+// MemoryStore keeps everything in process memory, for tests and demos.
+// Nothing survives a restart and every instance has its own data.
+type MemoryStore struct {
+	mu            sync.Mutex
+	users         map[uuid.UUID]database.User
+	verifications map[string]database.EmailVerificationToken
+	chirps        map[uuid.UUID]database.Chirp
+	revisions     map[uuid.UUID][]database.ChirpRevision
+	refreshTokens map[string]database.RefreshToken
+	now           func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{now: time.Now}
+	s.clear()
+	return s
+}
+
+func (s *MemoryStore) clear() {
+	s.users = map[uuid.UUID]database.User{}
+	s.verifications = map[string]database.EmailVerificationToken{}
+	s.chirps = map[uuid.UUID]database.Chirp{}
+	s.revisions = map[uuid.UUID][]database.ChirpRevision{}
+	s.refreshTokens = map[string]database.RefreshToken{}
+}
+
+// timestamp is NOW() as Postgres would store it, so values read back from
+// either store compare the same way.
+func (s *MemoryStore) timestamp() time.Time {
+	return s.now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *MemoryStore) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clear()
+	return nil
+}
+
+// Users
+
+func (s *MemoryStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, ErrEmailTaken
+	}
+	now := s.timestamp()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	s.users[user.ID] = user
+	return user, nil
+}
+
+// emailTaken reports whether a user other than except has email.
+func (s *MemoryStore) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range s.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *MemoryStore) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if s.emailTaken(arg.Email, arg.ID) {
+		return database.User{}, ErrEmailTaken
+	}
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = s.timestamp()
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[arg.ID]; ok {
+		user.HashedPassword = arg.HashedPassword
+		user.UpdatedAt = s.timestamp()
+		s.users[user.ID] = user
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetUserPendingEmail(ctx context.Context, arg database.SetUserPendingEmailParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[arg.ID]; ok {
+		user.PendingEmail = arg.PendingEmail
+		user.UpdatedAt = s.timestamp()
+		s.users[user.ID] = user
+	}
+	return nil
+}
+
+func (s *MemoryStore) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[arg.ID]
+	pending := user.PendingEmail.Valid && user.PendingEmail.String == arg.Email
+	if !ok || (user.Email != arg.Email && !pending) {
+		return database.User{}, sql.ErrNoRows
+	}
+	if s.emailTaken(arg.Email, arg.ID) {
+		return database.User{}, ErrEmailTaken
+	}
+	now := s.timestamp()
+	user.Email = arg.Email
+	user.EmailVerifiedAt = sql.NullTime{Time: now, Valid: true}
+	if pending {
+		user.PendingEmail = sql.NullString{}
+	}
+	user.UpdatedAt = now
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) CreateEmailVerificationToken(ctx context.Context, arg database.CreateEmailVerificationTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.UserID]; !ok {
+		return ErrReferenceMissing
+	}
+	if _, ok := s.verifications[arg.TokenHash]; ok {
+		return errDuplicateKey
+	}
+	s.verifications[arg.TokenHash] = database.EmailVerificationToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		CreatedAt: s.timestamp(),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (s *MemoryStore) UseEmailVerificationToken(ctx context.Context, tokenHash string) (database.UseEmailVerificationTokenRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	token, ok := s.verifications[tokenHash]
+	if !ok || token.UsedAt.Valid || !token.ExpiresAt.After(now) {
+		return database.UseEmailVerificationTokenRow{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: now, Valid: true}
+	s.verifications[tokenHash] = token
+	return database.UseEmailVerificationTokenRow{UserID: token.UserID, Email: token.Email}, nil
+}
+
+func (s *MemoryStore) DeleteEmailVerificationTokens(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.verifications {
+		if token.UserID == userID {
+			delete(s.verifications, hash)
+		}
+	}
+	return nil
+}
+
+// Chirps
+
+func (s *MemoryStore) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.Chirp{}, ErrReferenceMissing
+	}
+	if arg.InReplyTo.Valid {
+		parent, ok := s.chirps[arg.InReplyTo.UUID]
+		if !ok {
+			return database.Chirp{}, ErrReferenceMissing
+		}
+		parent.ReplyCount++
+		s.chirps[parent.ID] = parent
+	}
+
+	now := s.timestamp()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		InReplyTo: arg.InReplyTo,
+	}
+	s.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (s *MemoryStore) GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (s *MemoryStore) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.page(s.liveChirps(arg.AuthorID), arg.CursorCreatedAt, arg.CursorID, arg.RowLimit, false), nil
+}
+
+func (s *MemoryStore) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.page(s.liveChirps(arg.AuthorID), arg.CursorCreatedAt, arg.CursorID, arg.RowLimit, true), nil
+}
+
+// liveChirps are the chirps that aren't tombstones, optionally by one author.
+func (s *MemoryStore) liveChirps(author uuid.NullUUID) []database.Chirp {
+	var chirps []database.Chirp
+	for _, c := range s.chirps {
+		if c.DeletedAt.Valid || (author.Valid && c.UserID != author.UUID) {
+			continue
+		}
+		chirps = append(chirps, c)
+	}
+	return chirps
+}
+
+// page sorts chirps by (created_at, id) and returns up to limit of them
+// after the cursor, the way the keyset queries do.
+func (s *MemoryStore) page(chirps []database.Chirp, cursorCreatedAt sql.NullTime, cursorID uuid.NullUUID, limit int32, desc bool) []database.Chirp {
+	slices.SortFunc(chirps, compareChirps)
+	if desc {
+		slices.Reverse(chirps)
+	}
+
+	var result []database.Chirp
+	for _, c := range chirps {
+		if len(result) >= int(limit) {
+			break
+		}
+		if cursorCreatedAt.Valid {
+			cmp, ok := compareKey(c, cursorCreatedAt.Time, cursorID)
+			if !ok || (desc && cmp >= 0) || (!desc && cmp <= 0) {
+				continue
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+func compareChirps(a, b database.Chirp) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// compareKey compares (created_at, id) with a cursor like a Postgres row
+// comparison. ok is false where SQL would give NULL, which matches no rows.
+func compareKey(c database.Chirp, createdAt time.Time, id uuid.NullUUID) (cmp int, ok bool) {
+	if cmp := c.CreatedAt.Compare(createdAt); cmp != 0 {
+		return cmp, true
+	}
+	if !id.Valid {
+		return 0, false
+	}
+	return bytes.Compare(c.ID[:], id.UUID[:]), true
+}
+
+func (s *MemoryStore) UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	now := s.timestamp()
+	s.revisions[chirp.ID] = append(s.revisions[chirp.ID], database.ChirpRevision{
+		ID:         uuid.New(),
+		ChirpID:    chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.UpdatedAt,
+		ReplacedAt: now,
+	})
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = now
+	s.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (s *MemoryStore) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Newest first
+	revisions := slices.Clone(s.revisions[chirpID])
+	slices.Reverse(revisions)
+	return revisions, nil
+}
+
+// DeleteChirp deletes a chirp and its revisions, unless it has replies.
+// It returns how many chirps were deleted.
+func (s *MemoryStore) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirp, ok := s.chirps[id]
+	if !ok || chirp.ReplyCount > 0 {
+		return 0, nil
+	}
+	delete(s.chirps, id)
+	delete(s.revisions, id)
+
+	if parent, ok := s.chirps[chirp.InReplyTo.UUID]; ok && chirp.InReplyTo.Valid {
+		parent.ReplyCount--
+		s.chirps[parent.ID] = parent
+	}
+	return 1, nil
+}
+
+func (s *MemoryStore) TombstoneChirp(ctx context.Context, chirpID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revisions, chirpID)
+	if chirp, ok := s.chirps[chirpID]; ok {
+		now := s.timestamp()
+		chirp.Body = ""
+		chirp.UpdatedAt = now
+		chirp.DeletedAt = sql.NullTime{Time: now, Valid: true}
+		s.chirps[chirpID] = chirp
+	}
+	return nil
+}
+
+// GetChirpAncestors returns the chain of chirps a chirp replies to, root
+// first.
+func (s *MemoryStore) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ancestors []database.Chirp
+	chirp, ok := s.chirps[id]
+	for ok && chirp.InReplyTo.Valid {
+		chirp, ok = s.chirps[chirp.InReplyTo.UUID]
+		if ok {
+			ancestors = append(ancestors, chirp)
+		}
+	}
+	slices.Reverse(ancestors)
+	return ancestors, nil
+}
+
+func (s *MemoryStore) GetChirpDescendantsAsc(ctx context.Context, arg database.GetChirpDescendantsAscParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.page(s.descendants(arg.ChirpID), arg.CursorCreatedAt, arg.CursorID, arg.RowLimit, false), nil
+}
+
+func (s *MemoryStore) GetChirpDescendantsDesc(ctx context.Context, arg database.GetChirpDescendantsDescParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.page(s.descendants(arg.ChirpID), arg.CursorCreatedAt, arg.CursorID, arg.RowLimit, true), nil
+}
+
+// descendants are all replies under a chirp, tombstones included.
+func (s *MemoryStore) descendants(id uuid.UUID) []database.Chirp {
+	children := map[uuid.UUID][]database.Chirp{}
+	for _, c := range s.chirps {
+		if c.InReplyTo.Valid {
+			children[c.InReplyTo.UUID] = append(children[c.InReplyTo.UUID], c)
+		}
+	}
+
+	var result []database.Chirp
+	queue := []uuid.UUID{id}
+	for len(queue) > 0 {
+		replies := children[queue[0]]
+		queue = queue[1:]
+		for _, c := range replies {
+			result = append(result, c)
+			queue = append(queue, c.ID)
+		}
+	}
+	return result
+}
+
+// Refresh tokens
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, ErrReferenceMissing
+	}
+	if _, ok := s.refreshTokens[arg.Token]; ok {
+		return database.RefreshToken{}, errDuplicateKey
+	}
+	now := s.timestamp()
+	token := database.RefreshToken{
+		Token:       arg.Token,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		UserID:      arg.UserID,
+		ExpiresAt:   arg.ExpiresAt,
+		FamilyID:    arg.FamilyID,
+		UserAgent:   arg.UserAgent,
+		IpAddress:   arg.IpAddress,
+		DeviceLabel: arg.DeviceLabel,
+	}
+	s.refreshTokens[token.Token] = token
+	return token, nil
+}
+
+func (s *MemoryStore) GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// RotateRefreshToken revokes an unrevoked token and issues its successor in
+// the same family. It returns sql.ErrNoRows if the old token was already
+// revoked. The successor keeps the old token's expiry.
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.refreshTokens[arg.OldToken]
+	if !ok || old.RevokedAt.Valid {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	if _, ok := s.refreshTokens[arg.NewToken]; ok {
+		return database.RefreshToken{}, errDuplicateKey
+	}
+
+	now := s.timestamp()
+	old.UpdatedAt = now
+	old.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	old.ReplacedBy = sql.NullString{String: arg.NewToken, Valid: true}
+	s.refreshTokens[old.Token] = old
+
+	token := database.RefreshToken{
+		Token:       arg.NewToken,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		UserID:      old.UserID,
+		ExpiresAt:   old.ExpiresAt,
+		FamilyID:    old.FamilyID,
+		UserAgent:   old.UserAgent,
+		IpAddress:   arg.IpAddress,
+		DeviceLabel: old.DeviceLabel,
+	}
+	s.refreshTokens[token.Token] = token
+	return token, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.refreshTokens[token]; ok {
+		s.revoke(&t)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.FamilyID == familyID && !t.RevokedAt.Valid {
+			s.revoke(&t)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) revoke(t *database.RefreshToken) {
+	now := s.timestamp()
+	t.UpdatedAt = now
+	t.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	s.refreshTokens[t.Token] = *t
+}
+
+func (s *MemoryStore) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]database.ListActiveSessionsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timestamp()
+	started := map[uuid.UUID]time.Time{}
+	var active []database.RefreshToken
+	for _, t := range s.refreshTokens {
+		if first, ok := started[t.FamilyID]; !ok || t.CreatedAt.Before(first) {
+			started[t.FamilyID] = t.CreatedAt
+		}
+		if t.UserID == userID && !t.RevokedAt.Valid && t.ExpiresAt.After(now) {
+			active = append(active, t)
+		}
+	}
+	slices.SortFunc(active, func(a, b database.RefreshToken) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	var sessions []database.ListActiveSessionsRow
+	for _, t := range active {
+		sessions = append(sessions, database.ListActiveSessionsRow{
+			FamilyID:    t.FamilyID,
+			UserAgent:   t.UserAgent,
+			IpAddress:   t.IpAddress,
+			DeviceLabel: t.DeviceLabel,
+			ExpiresAt:   t.ExpiresAt,
+			LastUsedAt:  t.CreatedAt,
+			CreatedAt:   started[t.FamilyID],
+		})
+	}
+	return sessions, nil
+}
+
+func (s *MemoryStore) RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, t := range s.refreshTokens {
+		if t.UserID == arg.UserID && t.FamilyID == arg.FamilyID && !t.RevokedAt.Valid {
+			s.revoke(&t)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, arg database.RevokeUserSessionsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.UserID != arg.UserID || t.RevokedAt.Valid {
+			continue
+		}
+		if arg.ExceptFamilyID.Valid && t.FamilyID == arg.ExceptFamilyID.UUID {
+			continue
+		}
+		s.revoke(&t)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+// PostgresStore is the Store backed by the sqlc queries. Only the errors
+// callers act on are translated.
+type PostgresStore struct {
+	*database.Queries
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{Queries: db}
+}
+
+func (s *PostgresStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user, err := s.Queries.CreateUser(ctx, arg)
+	return user, translate(err)
+}
+
+func (s *PostgresStore) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	user, err := s.Queries.UpdateUser(ctx, arg)
+	return user, translate(err)
+}
+
+func (s *PostgresStore) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error) {
+	user, err := s.Queries.VerifyUserEmail(ctx, arg)
+	return user, translate(err)
+}
+
+func (s *PostgresStore) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	chirp, err := s.Queries.CreateChirp(ctx, arg)
+	return chirp, translate(err)
+}
+
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	token, err := s.Queries.CreateRefreshToken(ctx, arg)
+	return token, translate(err)
+}
+
+func (s *PostgresStore) CreateEmailVerificationToken(ctx context.Context, arg database.CreateEmailVerificationTokenParams) error {
+	return translate(s.Queries.CreateEmailVerificationToken(ctx, arg))
+}
+
+// translate maps the constraint violations MemoryStore also checks to its
+// errors.
+func translate(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case "23505":
+		if pqErr.Constraint == "users_email_key" {
+			return ErrEmailTaken
+		}
+	case "23503":
+		return ErrReferenceMissing
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+// Package storage is the repository layer for users, chirps and refresh
+// tokens.
+//
+// The methods are named after the sqlc queries they stand for and take the
+// same parameter and model types, so handlers switch backends without
+// changing, and PostgresStore is mostly the generated code itself.
+// MemoryStore keeps the same rules as the schema: lookups that find nothing
+// return sql.ErrNoRows, emails are unique, and deleting a row deletes or
+// detaches the rows that reference it.
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+// ErrEmailTaken is returned when creating or changing a user would give two
+// accounts the same email.
+var ErrEmailTaken = errors.New("storage: email already in use")
+
+// ErrReferenceMissing is returned when a row refers to a user or chirp that
+// doesn't exist.
+var ErrReferenceMissing = errors.New("storage: referenced row does not exist")
+
+type Users interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error)
+	UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error
+
+	// Email verification
+	SetUserPendingEmail(ctx context.Context, arg database.SetUserPendingEmailParams) error
+	VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error)
+	CreateEmailVerificationToken(ctx context.Context, arg database.CreateEmailVerificationTokenParams) error
+	UseEmailVerificationToken(ctx context.Context, tokenHash string) (database.UseEmailVerificationTokenRow, error)
+	DeleteEmailVerificationTokens(ctx context.Context, userID uuid.UUID) error
+}
+
+type Chirps interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error)
+	UpdateChirpBody(ctx context.Context, arg database.UpdateChirpBodyParams) (database.Chirp, error)
+	GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error)
+	TombstoneChirp(ctx context.Context, chirpID uuid.UUID) error
+
+	// Threads
+	GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error)
+	GetChirpDescendantsAsc(ctx context.Context, arg database.GetChirpDescendantsAscParams) ([]database.Chirp, error)
+	GetChirpDescendantsDesc(ctx context.Context, arg database.GetChirpDescendantsDescParams) ([]database.Chirp, error)
+}
+
+type RefreshTokens interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+
+	// Sessions are refresh token families
+	ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]database.ListActiveSessionsRow, error)
+	RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error)
+	RevokeUserSessions(ctx context.Context, arg database.RevokeUserSessionsParams) error
+}
+
+type Store interface {
+	Users
+	Chirps
+	RefreshTokens
+
+	// Reset deletes every user, and with them everything they own.
+	Reset(ctx context.Context) error
+}
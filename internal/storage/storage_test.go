@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+// The same tests run against both stores. The Postgres run needs a migrated
+// database it may wipe, e.g.
+// STORAGE_TEST_DB_URL=postgres://localhost/chirpy_test?sslmode=disable.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	result := map[string]Store{"memory": NewMemoryStore()}
+
+	if url := os.Getenv("STORAGE_TEST_DB_URL"); url != "" {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		result["postgres"] = NewPostgresStore(database.New(db))
+	}
+	return result
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, ctx context.Context, s Store)) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := s.Reset(ctx); err != nil {
+				t.Fatal(err)
+			}
+			test(t, ctx, s)
+		})
+	}
+}
+
+func createUser(t *testing.T, ctx context.Context, s Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func createChirp(t *testing.T, ctx context.Context, s Store, userID uuid.UUID, inReplyTo uuid.NullUUID) database.Chirp {
+	t.Helper()
+	chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: userID, InReplyTo: inReplyTo})
+	if err != nil {
+		t.Fatalf("CreateChirp: %v", err)
+	}
+	return chirp
+}
+
+func TestUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		bob := createUser(t, ctx, s, "bob@example.com")
+
+		_, err := s.CreateUser(ctx, database.CreateUserParams{Email: "alice@example.com", HashedPassword: "hash"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("duplicate CreateUser: got %v, want ErrEmailTaken", err)
+		}
+		_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: bob.ID, Email: alice.Email, HashedPassword: "hash"})
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("UpdateUser to a taken email: got %v, want ErrEmailTaken", err)
+		}
+		_, err = s.UpdateUser(ctx, database.UpdateUserParams{ID: uuid.New(), Email: "carol@example.com"})
+		if err != sql.ErrNoRows {
+			t.Errorf("UpdateUser of a missing user: got %v, want sql.ErrNoRows", err)
+		}
+
+		got, err := s.GetUserByEmail(ctx, "alice@example.com")
+		if err != nil || got.ID != alice.ID {
+			t.Errorf("GetUserByEmail = %v, %v", got.ID, err)
+		}
+		if _, err := s.GetUserByEmail(ctx, "nobody@example.com"); err != sql.ErrNoRows {
+			t.Errorf("GetUserByEmail of a missing user: got %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetUserByID(ctx, uuid.New()); err != sql.ErrNoRows {
+			t.Errorf("GetUserByID of a missing user: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		createUser(t, ctx, s, "bob@example.com")
+
+		err := s.SetUserPendingEmail(ctx, database.SetUserPendingEmailParams{
+			ID:           alice.ID,
+			PendingEmail: sql.NullString{String: "alice@example.org", Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+			TokenHash: "hash",
+			UserID:    alice.ID,
+			Email:     "alice@example.org",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := s.UseEmailVerificationToken(ctx, "hash")
+		if err != nil || token.Email != "alice@example.org" {
+			t.Fatalf("UseEmailVerificationToken = %+v, %v", token, err)
+		}
+		if _, err := s.UseEmailVerificationToken(ctx, "hash"); err != sql.ErrNoRows {
+			t.Errorf("reusing a token: got %v, want sql.ErrNoRows", err)
+		}
+
+		user, err := s.VerifyUserEmail(ctx, database.VerifyUserEmailParams{Email: token.Email, ID: token.UserID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "alice@example.org" || user.PendingEmail.Valid || !user.EmailVerifiedAt.Valid {
+			t.Errorf("after verifying: %+v", user)
+		}
+		_, err = s.VerifyUserEmail(ctx, database.VerifyUserEmailParams{Email: "bob@example.com", ID: alice.ID})
+		if err != sql.ErrNoRows {
+			t.Errorf("verifying an address that was never requested: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestChirpReplies(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		root := createChirp(t, ctx, s, alice.ID, uuid.NullUUID{})
+		reply := createChirp(t, ctx, s, alice.ID, uuid.NullUUID{UUID: root.ID, Valid: true})
+		nested := createChirp(t, ctx, s, alice.ID, uuid.NullUUID{UUID: reply.ID, Valid: true})
+
+		root, _ = s.GetChirpByID(ctx, root.ID)
+		if root.ReplyCount != 1 {
+			t.Errorf("root reply_count = %d, want 1", root.ReplyCount)
+		}
+
+		ancestors, err := s.GetChirpAncestors(ctx, nested.ID)
+		if err != nil || len(ancestors) != 2 || ancestors[0].ID != root.ID || ancestors[1].ID != reply.ID {
+			t.Errorf("GetChirpAncestors = %v, %v; want root then reply", ids(ancestors), err)
+		}
+		descendants, err := s.GetChirpDescendantsAsc(ctx, database.GetChirpDescendantsAscParams{ChirpID: root.ID, RowLimit: 10})
+		if err != nil || len(descendants) != 2 {
+			t.Errorf("GetChirpDescendantsAsc = %v, %v; want 2 chirps", ids(descendants), err)
+		}
+
+		// A chirp with replies isn't deleted
+		if deleted, err := s.DeleteChirp(ctx, reply.ID); err != nil || deleted != 0 {
+			t.Errorf("DeleteChirp of a chirp with replies = %d, %v; want 0", deleted, err)
+		}
+
+		// Once its reply is gone it is, and the parent's count follows
+		for _, id := range []uuid.UUID{nested.ID, reply.ID} {
+			if deleted, err := s.DeleteChirp(ctx, id); err != nil || deleted != 1 {
+				t.Fatalf("DeleteChirp = %d, %v; want 1", deleted, err)
+			}
+		}
+		root, _ = s.GetChirpByID(ctx, root.ID)
+		if root.ReplyCount != 0 {
+			t.Errorf("root reply_count after delete = %d, want 0", root.ReplyCount)
+		}
+
+		_, err = s.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: alice.ID, InReplyTo: uuid.NullUUID{UUID: reply.ID, Valid: true}})
+		if !errors.Is(err, ErrReferenceMissing) {
+			t.Errorf("replying to a deleted chirp: got %v, want ErrReferenceMissing", err)
+		}
+		_, err = s.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: uuid.New()})
+		if !errors.Is(err, ErrReferenceMissing) {
+			t.Errorf("chirp by a missing user: got %v, want ErrReferenceMissing", err)
+		}
+	})
+}
+
+func TestChirpRevisionsAndTombstones(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		chirp := createChirp(t, ctx, s, alice.ID, uuid.NullUUID{})
+
+		for _, body := range []string{"second", "third"} {
+			if _, err := s.UpdateChirpBody(ctx, database.UpdateChirpBodyParams{ID: chirp.ID, Body: body}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		revisions, err := s.GetChirpRevisions(ctx, chirp.ID)
+		if err != nil || len(revisions) != 2 || revisions[0].Body != "second" || revisions[1].Body != "hello" {
+			t.Errorf("GetChirpRevisions = %+v, %v; want second then hello", revisions, err)
+		}
+		if _, err := s.UpdateChirpBody(ctx, database.UpdateChirpBodyParams{ID: uuid.New(), Body: "x"}); err != sql.ErrNoRows {
+			t.Errorf("UpdateChirpBody of a missing chirp: got %v, want sql.ErrNoRows", err)
+		}
+
+		if err := s.TombstoneChirp(ctx, chirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		revisions, _ = s.GetChirpRevisions(ctx, chirp.ID)
+		if len(revisions) != 0 {
+			t.Errorf("tombstone kept %d revisions", len(revisions))
+		}
+		listed, _ := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{RowLimit: 10})
+		if len(listed) != 0 {
+			t.Errorf("tombstone is still listed")
+		}
+		chirp, err = s.GetChirpByID(ctx, chirp.ID)
+		if err != nil || !chirp.DeletedAt.Valid || chirp.Body != "" {
+			t.Errorf("GetChirpByID of a tombstone = %+v, %v", chirp, err)
+		}
+	})
+}
+
+func TestListChirpsPages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		bob := createUser(t, ctx, s, "bob@example.com")
+		for range 3 {
+			createChirp(t, ctx, s, alice.ID, uuid.NullUUID{})
+		}
+		createChirp(t, ctx, s, bob.ID, uuid.NullUUID{})
+
+		author := uuid.NullUUID{UUID: alice.ID, Valid: true}
+		first, err := s.ListChirpsDesc(ctx, database.ListChirpsDescParams{AuthorID: author, RowLimit: 2})
+		if err != nil || len(first) != 2 {
+			t.Fatalf("first page = %v, %v", ids(first), err)
+		}
+		last := first[len(first)-1]
+		second, err := s.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+			AuthorID:        author,
+			CursorCreatedAt: sql.NullTime{Time: last.CreatedAt, Valid: true},
+			CursorID:        uuid.NullUUID{UUID: last.ID, Valid: true},
+			RowLimit:        2,
+		})
+		if err != nil || len(second) != 1 {
+			t.Fatalf("second page = %v, %v", ids(second), err)
+		}
+
+		all, _ := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{AuthorID: author, RowLimit: 10})
+		want := []uuid.UUID{second[0].ID, first[1].ID, first[0].ID}
+		if got := ids(all); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Errorf("ascending = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		family := uuid.New()
+		expires := time.Now().Add(time.Hour)
+		first, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token: "one", UserID: alice.ID, ExpiresAt: expires, FamilyID: family, DeviceLabel: "laptop",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token: "other", UserID: alice.ID, ExpiresAt: expires, FamilyID: uuid.New(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotated, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{NewToken: "two", OldToken: "one"})
+		if err != nil || rotated.FamilyID != family || rotated.DeviceLabel != "laptop" {
+			t.Fatalf("RotateRefreshToken = %+v, %v", rotated, err)
+		}
+		if !rotated.ExpiresAt.Equal(first.ExpiresAt) {
+			t.Errorf("rotation moved the expiry from %v to %v", first.ExpiresAt, rotated.ExpiresAt)
+		}
+		old, _ := s.GetUserFromRefreshToken(ctx, "one")
+		if !old.RevokedAt.Valid || old.ReplacedBy.String != "two" {
+			t.Errorf("rotated token = %+v, want revoked and replaced by two", old)
+		}
+		_, err = s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{NewToken: "three", OldToken: "one"})
+		if err != sql.ErrNoRows {
+			t.Errorf("rotating a revoked token: got %v, want sql.ErrNoRows", err)
+		}
+
+		sessions, err := s.ListActiveSessions(ctx, alice.ID)
+		if err != nil || len(sessions) != 2 {
+			t.Fatalf("ListActiveSessions = %+v, %v; want 2 sessions", sessions, err)
+		}
+
+		err = s.RevokeUserSessions(ctx, database.RevokeUserSessionsParams{
+			UserID:         alice.ID,
+			ExceptFamilyID: uuid.NullUUID{UUID: family, Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions, _ = s.ListActiveSessions(ctx, alice.ID)
+		if len(sessions) != 1 || sessions[0].FamilyID != family {
+			t.Errorf("after revoking other sessions: %+v", sessions)
+		}
+		n, err := s.RevokeUserSession(ctx, database.RevokeUserSessionParams{UserID: alice.ID, FamilyID: family})
+		if err != nil || n != 1 {
+			t.Errorf("RevokeUserSession = %d, %v; want 1", n, err)
+		}
+	})
+}
+
+func TestResetCascades(t *testing.T) {
+	forEachStore(t, func(t *testing.T, ctx context.Context, s Store) {
+		alice := createUser(t, ctx, s, "alice@example.com")
+		chirp := createChirp(t, ctx, s, alice.ID, uuid.NullUUID{})
+		_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			Token: "one", UserID: alice.ID, ExpiresAt: time.Now().Add(time.Hour), FamilyID: uuid.New(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Reset(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetChirpByID(ctx, chirp.ID); err != sql.ErrNoRows {
+			t.Errorf("chirp after reset: got %v, want sql.ErrNoRows", err)
+		}
+		if _, err := s.GetUserFromRefreshToken(ctx, "one"); err != sql.ErrNoRows {
+			t.Errorf("refresh token after reset: got %v, want sql.ErrNoRows", err)
+		}
+		// The email is free again
+		createUser(t, ctx, s, "alice@example.com")
+	})
+}
+
+func ids(chirps []database.Chirp) []uuid.UUID {
+	result := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		result[i] = c.ID
+	}
+	return result
+}
@@ -2,16 +2,17 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
 )
 
+// respondWithError sends msg to the client. The error, which may have
+// details the client shouldn't see, goes to the request's access log line.
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+	if !logging.RecordError(w, msg, err) && (err != nil || code > 499) {
+		slog.Error("Responding with error", "status", code, "error_message", msg, "error", err)
 	}
 	type errorResponse struct {
 		Error string `json:"error"`
@@ -25,7 +26,7 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
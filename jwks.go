@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+// jwtKeyReloadInterval is how often keys are re-read from their source, so
+// every instance picks up a rotation within a minute.
+const jwtKeyReloadInterval = time.Minute
+
+// jwksMaxAge is how long clients may cache the JWKS.
+const jwksMaxAge = 5 * time.Minute
+
+// jwtKeyPublishDelay is how long a new key from the database is in the
+// JWKS before anything is signed with it: long enough for every instance
+// to reload it and for cached copies of the JWKS to expire.
+const jwtKeyPublishDelay = jwtKeyReloadInterval + jwksMaxAge
+
+// keyManager keeps the signing keyset in sync with its source:
+//
+//   - secret: a single HS256 key, BEARER itself (the default)
+//   - file:   PEM files in JWT_KEYS_DIR, named <kid>.pem
+//   - db:     the jwt_keys table, rotated every JWT_ROTATION_INTERVAL and
+//     encrypted with JWT_KEY_ENCRYPTION_KEY
+//
+// Tokens without a kid are always checked against BEARER so sessions issued
+// before key rotation was introduced keep working.
+type keyManager struct {
+	keys     *auth.KeySet
+	db       *database.Queries
+	secret   string
+	source   string
+	dir      string
+	kid      string
+	alg      string
+	sealKey  string
+	rotation time.Duration
+	// accessTTL keeps rotated keys around until tokens signed with them
+	// have expired.
+	accessTTL time.Duration
+}
+
+func (m *keyManager) load(ctx context.Context) error {
+	switch m.source {
+	case "", "secret":
+		// The kid goes out in every token header, so it mustn't be derived
+		// from the secret
+		kid := m.kid
+		if kid == "" {
+			kid = "hs256"
+		}
+		return m.keys.SetKeys(auth.NewHMACKey(kid, []byte(m.secret)), nil)
+	case "file":
+		return m.loadDir()
+	case "db":
+		return m.loadDB(ctx)
+	default:
+		return fmt.Errorf("unknown JWT_KEY_SOURCE %q", m.source)
+	}
+}
+
+// loadDir signs with JWT_SIGNING_KID if set, otherwise with the last key by
+// file name, so date-prefixed file names rotate on their own.
+func (m *keyManager) loadDir() error {
+	keys, err := auth.LoadKeyDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	var signing *auth.Key
+	for _, k := range keys {
+		if !k.CanSign() {
+			continue
+		}
+		if m.kid == "" || k.ID == m.kid {
+			signing = k
+		}
+	}
+	if signing == nil {
+		return fmt.Errorf("no private signing key found in %s", m.dir)
+	}
+	return m.keys.SetKeys(signing, keys)
+}
+
+// loadDB creates a key when the newest is older than the rotation
+// interval, and signs with the newest key that has been published for
+// jwtKeyPublishDelay. Retired keys stay valid until every access token they
+// signed has expired.
+func (m *keyManager) loadDB(ctx context.Context) error {
+	rows, err := m.db.ListJWTKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 || time.Since(rows[0].CreatedAt) >= m.rotation {
+		generation := int64(1)
+		if len(rows) > 0 {
+			generation = rows[0].Generation + 1
+		}
+		created, err := m.createDBKey(ctx, generation)
+		if err == sql.ErrNoRows {
+			// Another instance rotated at the same time
+			rows, err = m.db.ListJWTKeys(ctx)
+		} else if err == nil {
+			rows = append([]database.JwtKey{created}, rows...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no JWT keys in the database")
+	}
+
+	keys := make([]*auth.Key, 0, len(rows))
+	for _, row := range rows {
+		key, err := auth.OpenKey(row.Kid, row.PrivateKey, m.sealKey)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %w", row.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	return m.keys.SetKeys(keys[signingKey(rows, time.Now())], keys)
+}
+
+// signingKey returns the index of the newest key published for at least
+// jwtKeyPublishDelay. rows are ordered newest first. While none is, such as
+// right after the first key is created, the oldest is used.
+func signingKey(rows []database.JwtKey, now time.Time) int {
+	for i, row := range rows {
+		if now.Sub(row.CreatedAt) >= jwtKeyPublishDelay {
+			return i
+		}
+	}
+	return len(rows) - 1
+}
+
+// createDBKey stores a new key as the given generation. It returns
+// sql.ErrNoRows if the generation already exists.
+func (m *keyManager) createDBKey(ctx context.Context, generation int64) (database.JwtKey, error) {
+	key, err := auth.GenerateKey(m.alg)
+	if err != nil {
+		return database.JwtKey{}, err
+	}
+	privateKey, err := auth.SealKey(key, m.sealKey)
+	if err != nil {
+		return database.JwtKey{}, err
+	}
+
+	created, err := m.db.CreateJWTKey(ctx, database.CreateJWTKeyParams{
+		Kid:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: privateKey,
+		// Signs from jwtKeyPublishDelay after creation until its successor
+		// does, which each instance notices up to a reload late
+		ExpiresAt:  time.Now().Add(jwtKeyPublishDelay + m.rotation + 2*jwtKeyReloadInterval + m.accessTTL),
+		Generation: generation,
+	})
+	if err != nil {
+		return database.JwtKey{}, err
+	}
+	slog.Info("Created JWT signing key", "kid", created.Kid, "signing_after", jwtKeyPublishDelay)
+	return created, nil
+}
+
+// run reloads keys until ctx is done. Errors are logged and the previous
+// keys stay in use.
+func (m *keyManager) run(ctx context.Context) {
+	if m.source == "" || m.source == "secret" {
+		return
+	}
+
+	ticker := time.NewTicker(jwtKeyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := m.load(ctx); err != nil {
+			slog.Error("Couldn't reload JWT keys", "error", err)
+		}
+		if m.source == "db" {
+			if _, err := m.db.DeleteExpiredJWTKeys(ctx); err != nil {
+				slog.Error("Couldn't delete expired JWT keys", "error", err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	respondWithJSON(w, http.StatusOK, cfg.keys.JWKS())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+)
+
+func TestSigningKey(t *testing.T) {
+	now := time.Now()
+	key := func(age time.Duration) database.JwtKey {
+		return database.JwtKey{CreatedAt: now.Add(-age)}
+	}
+
+	tests := []struct {
+		name string
+		rows []database.JwtKey
+		want int
+	}{
+		{"only key", []database.JwtKey{key(time.Second)}, 0},
+		{"new key not published yet", []database.JwtKey{key(time.Minute), key(30 * 24 * time.Hour)}, 1},
+		{"new key published", []database.JwtKey{key(jwtKeyPublishDelay), key(30 * 24 * time.Hour)}, 0},
+		{"nothing published yet", []database.JwtKey{key(time.Second), key(time.Minute)}, 1},
+	}
+	for _, tt := range tests {
+		if got := signingKey(tt.rows, now); got != tt.want {
+			t.Errorf("%s: expected key %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
+)
+
+const (
+	loginScopeAccount = "account"
+	loginScopeIP      = "ip"
+)
+
+// loginGuard slows down password guessing. Failures are counted per account
+// and per client IP in the login_failures table, so limits hold across
+// restarts and instances. Once a counter reaches its threshold, every
+// further failure locks it for twice as long as the last, up to maxLockout.
+// A nil guard, used with STORAGE=memory, lets every attempt through.
+type loginGuard struct {
+	db          *database.Queries
+	maxAccount  int32
+	maxIP       int32
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	logins      *metrics.CounterVec
+}
+
+// allow reports whether a login attempt may proceed. It writes a 429 with
+// Retry-After when the account or the client IP is locked.
+func (g *loginGuard) allow(w http.ResponseWriter, r *http.Request, email string) bool {
+	if g == nil {
+		return true
+	}
+	retryAfter, err := g.db.GetLoginRetryAfter(r.Context(), database.GetLoginRetryAfterParams{
+		Account: loginAccountKey(email),
+		Ip:      clientip.FromRequest(r),
+	})
+	if err != nil {
+		// Don't lock everyone out because the table is unavailable
+		logging.FromContext(r.Context()).Error("Couldn't check login lockout", "error", err)
+		return true
+	}
+	if retryAfter <= 0 {
+		return true
+	}
+	g.logins.With("locked").Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+	return false
+}
+
+func (g *loginGuard) recordFailure(r *http.Request, email string) {
+	if g == nil {
+		return
+	}
+	g.logins.With("failure").Inc()
+	g.record(r.Context(), loginScopeAccount, loginAccountKey(email), g.maxAccount)
+	g.record(r.Context(), loginScopeIP, clientip.FromRequest(r), g.maxIP)
+}
+
+func (g *loginGuard) record(ctx context.Context, scope, key string, threshold int32) {
+	failures, err := g.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Scope:       scope,
+		Key:         key,
+		ResetBefore: time.Now().Add(-g.maxLockout),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't record login failure", "scope", scope, "error", err)
+		return
+	}
+	if failures < threshold {
+		return
+	}
+
+	err = g.db.LockLogin(ctx, database.LockLoginParams{
+		Seconds: int32(g.lockoutFor(failures, threshold).Seconds()),
+		Scope:   scope,
+		Key:     key,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't lock login", "scope", scope, "error", err)
+	}
+}
+
+// lockoutFor doubles the lockout for every failure past the threshold.
+func (g *loginGuard) lockoutFor(failures, threshold int32) time.Duration {
+	d := g.baseLockout
+	for i := threshold; i < failures && d < g.maxLockout; i++ {
+		d *= 2
+	}
+	return min(d, g.maxLockout)
+}
+
+// recordSuccess forgets the account's failures. The IP counter is kept, or
+// an attacker could reset it by logging into an account of their own.
+func (g *loginGuard) recordSuccess(ctx context.Context, email string) {
+	if g == nil {
+		return
+	}
+	_, err := g.db.ClearLoginFailures(ctx, database.ClearLoginFailuresParams{
+		Scope: loginScopeAccount,
+		Key:   loginAccountKey(email),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't clear login failures", "error", err)
+	}
+}
+
+// cleanup deletes counters that have been quiet for longer than the reset
+// window, until ctx is done.
+func (g *loginGuard) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := g.db.DeleteStaleLoginFailures(ctx, time.Now().Add(-g.maxLockout)); err != nil {
+			slog.Error("Couldn't delete stale login failures", "error", err)
+		}
+	}
+}
+
+func loginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
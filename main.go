@@ -1,67 +1,212 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/clientip"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/config"
 	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/filter"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/health"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/mail"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/ratelimit"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/storage"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	platform       string
-	jwtSecret      string
-	polkaKey       string
+	metrics    *appMetrics
+	draining   atomic.Bool
+	background sync.WaitGroup
+	store      storage.Store
+	// db serves the features outside the storage layer. It is nil with
+	// STORAGE=memory, and those features are switched off.
+	db         *database.Queries
+	platform   string
+	keys       *auth.KeySet
+	adminKey   string
+	filter     *filter.Filter
+	mailer     mail.Mailer
+	loginGuard *loginGuard
+	webhooks   *webhookInbox
+	outbound   *webhookDispatcher
+
+	unverifiedPolicy string
+
+	polkaAuth               string
+	polkaKey                string
+	polkaSecrets            []string
+	polkaSignatureTolerance time.Duration
+
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
+
+	maxChirpLength     int
+	chirpEditWindow    time.Duration
+	chirpEditWindowRed time.Duration
 }
 
 func main() {
-	const filepathRoot = "."
-	const port = "8080"
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "optional .toml or .yaml config `file`")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flag.Parse()
 
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Fatal("DB_URL must be set")
+	conf, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%s", err)
 	}
-	platform := os.Getenv("PLATFORM")
-	if platform == "" {
-		log.Fatal("PLATFORM must be set")
+	if *printConfig {
+		conf.Print(os.Stdout)
+		return
 	}
 
-	jwtSecret := os.Getenv("BEARER")
-	if jwtSecret == "" {
-		log.Fatal("jwtSecret must be set")
+	logger, err := logging.New(os.Stderr, conf.LogLevel, conf.LogFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+	if conf.PolkaAuth == polkaAuthAPIKey && conf.Storage == "postgres" {
+		slog.Warn("Polka webhooks are checked against the static POLKA_KEY; set POLKA_WEBHOOK_SECRETS to verify signatures instead")
 	}
 
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		log.Fatal("POLKA_KEY must be set")
+	registry := metrics.NewRegistry()
+	appMetrics := newAppMetrics(registry)
+
+	var dbConn *sql.DB
+	var dbQueries *database.Queries
+	var store storage.Store
+	switch conf.Storage {
+	case "postgres":
+		dbConn, err = sql.Open("postgres", conf.DBURL)
+		if err != nil {
+			log.Fatalf("Error opening database: %s", err)
+		}
+		dbConn.SetMaxOpenConns(conf.DBMaxOpenConns)
+		dbConn.SetMaxIdleConns(conf.DBMaxIdleConns)
+		dbConn.SetConnMaxLifetime(conf.DBConnMaxLifetime)
+		dbConn.SetConnMaxIdleTime(conf.DBConnMaxIdleTime)
+		metrics.RegisterDBStats(registry, dbConn)
+		dbQueries = database.New(metrics.InstrumentDB(registry, dbConn))
+		store = storage.NewPostgresStore(dbQueries)
+	case "memory":
+		slog.Warn("Using in-memory storage: data is lost on restart and features that need Postgres are off",
+			"features", []string{"login lockouts", "moderation queue", "Polka webhooks", "outgoing webhooks", "subscriptions"})
+		store = storage.NewMemoryStore()
 	}
 
-	dbConn, err := sql.Open("postgres", dbURL)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	chirpFilter, err := loadFilter(dbQueries, conf.ProfanityFile)
 	if err != nil {
-		log.Fatalf("Error opening database: %s", err)
+		log.Fatalf("Error loading profanity filter: %s", err)
 	}
-	dbQueries := database.New(dbConn)
+
+	mailer, err := newMailer(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys := &keyManager{
+		keys:      auth.NewKeySet(conf.JWTSecret),
+		db:        dbQueries,
+		secret:    conf.JWTSecret,
+		source:    conf.JWTKeySource,
+		dir:       conf.JWTKeysDir,
+		kid:       conf.JWTSigningKID,
+		alg:       conf.JWTAlgorithm,
+		sealKey:   conf.JWTKeyEncryptionKey,
+		rotation:  conf.JWTRotationInterval,
+		accessTTL: conf.AccessTokenDuration,
+	}
+	if err := keys.load(ctx); err != nil {
+		log.Fatalf("Error loading JWT keys: %s", err)
+	}
+	go keys.run(ctx)
 
 	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		platform:       platform,
-		polkaKey:       polkaKey,
+		metrics:  appMetrics,
+		store:    store,
+		db:       dbQueries,
+		platform: conf.Platform,
+		keys:     keys.keys,
+		adminKey: conf.AdminKey,
+		filter:   chirpFilter,
+		mailer:   mailer,
+
+		unverifiedPolicy: conf.UnverifiedPolicy,
+
+		polkaAuth:               conf.PolkaAuth,
+		polkaKey:                conf.PolkaKey,
+		polkaSecrets:            conf.PolkaWebhookSecrets,
+		polkaSignatureTolerance: conf.PolkaSignatureTolerance,
+
+		accessTokenDuration:  conf.AccessTokenDuration,
+		refreshTokenDuration: conf.RefreshTokenDuration,
+
+		maxChirpLength:     conf.ChirpMaxLength,
+		chirpEditWindow:    conf.ChirpEditWindow,
+		chirpEditWindowRed: conf.ChirpEditWindowRed,
+	}
+
+	// Check errors can reveal infrastructure details, so ?verbose only
+	// shows them to admins
+	checks := &health.Registry{ShowErrors: apiCfg.isAdmin}
+	checks.AddReadiness("shutdown", apiCfg.drainingCheck)
+	if dbQueries != nil {
+		apiCfg.loginGuard = &loginGuard{
+			db:          dbQueries,
+			maxAccount:  int32(conf.LoginMaxAttempts),
+			maxIP:       int32(conf.LoginMaxAttemptsIP),
+			baseLockout: conf.LoginLockout,
+			maxLockout:  conf.LoginLockoutMax,
+			logins:      appMetrics.logins,
+		}
+		apiCfg.webhooks = newWebhookInbox(dbQueries, appMetrics.webhookEvents)
+		apiCfg.webhooks.processors[webhookSourcePolka] = apiCfg.processPolkaEvent
+		apiCfg.outbound = newWebhookDispatcher(dbQueries, appMetrics.deliveries, conf.WebhookDeliveryTimeout, conf.Platform == "dev")
+		go apiCfg.loginGuard.cleanup(ctx)
+		go reloadFilter(ctx, chirpFilter, dbQueries, conf.ProfanityFile)
+		// Tracked so shutdown waits for the job at hand before the
+		// database is closed
+		apiCfg.background.Go(func() { apiCfg.webhooks.run(ctx) })
+		apiCfg.background.Go(func() { apiCfg.outbound.run(ctx) })
+		go apiCfg.expireSubscriptions(ctx)
+
+		migration, err := expectedMigration()
+		if err != nil {
+			log.Fatalf("Error reading migrations: %s", err)
+		}
+		checks.AddReadiness("database", health.Ping(dbConn))
+		checks.AddReadiness("migrations", migrationCheck(dbConn, migration))
 	}
+	checks.AddReadiness("disk", health.DiskSpace(conf.FilepathRoot, uint64(conf.HealthMinDiskFreeMB)<<20))
 
 	mux := http.NewServeMux()
-	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
+	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(conf.FilepathRoot))))
 	mux.Handle("/app/", fsHandler)
 
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /api/healthz", apiCfg.handlerReadiness)
+	mux.Handle("GET /api/livez", checks.LivenessHandler())
+	mux.Handle("GET /api/readyz", checks.ReadinessHandler())
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
 
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsGet)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
@@ -70,19 +215,241 @@ func main() {
 	mux.HandleFunc("POST /api/login", apiCfg.handlerUsersLogin)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefreshCreate)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeCreate)
+	mux.HandleFunc("GET /api/sessions", apiCfg.handlerSessionsGet)
+	mux.HandleFunc("DELETE /api/sessions", apiCfg.handlerSessionsDelete)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.handlerSessionDelete)
 	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerEmailVerify)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.handlerEmailVerifyResend)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpDelete)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUpgradeUsersToChirpyRed)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", apiCfg.handlerChirpUpdate)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handlerChirpRevisionsGet)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", apiCfg.handlerChirpThreadGet)
 
 	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	mux.Handle("GET /metrics", apiCfg.adminOnly(registry.Handler()))
+
+	// Features without a memory backend, left out with STORAGE=memory
+	postgresRoutes := []struct {
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"GET /api/chirps/search", apiCfg.handlerChirpsSearch},
+		{"POST /api/login/mfa", apiCfg.handlerLoginMFA},
+		{"POST /api/password/forgot", apiCfg.handlerPasswordForgot},
+		{"POST /api/password/reset", apiCfg.handlerPasswordReset},
+		{"POST /api/users/2fa/setup", apiCfg.handlerTOTPSetup},
+		{"POST /api/users/2fa/confirm", apiCfg.handlerTOTPConfirm},
+		{"POST /api/users/2fa/disable", apiCfg.handlerTOTPDisable},
+		{"POST /api/chirps/{chirpID}/like", apiCfg.handlerChirpLike},
+		{"DELETE /api/chirps/{chirpID}/like", apiCfg.handlerChirpUnlike},
+		{"POST /api/polka/webhooks", apiCfg.handlerPolkaWebhooks},
+		{"POST /api/users/{userID}/follow", apiCfg.handlerFollowCreate},
+		{"DELETE /api/users/{userID}/follow", apiCfg.handlerFollowDelete},
+		{"GET /api/users/{userID}/followers", apiCfg.handlerFollowersGet},
+		{"GET /api/users/{userID}/following", apiCfg.handlerFollowingGet},
+		{"GET /api/users/{userID}/likes", apiCfg.handlerUserLikesGet},
+		{"GET /api/users/me/subscription", apiCfg.handlerSubscriptionGet},
+		{"POST /api/webhooks", apiCfg.handlerWebhookEndpointCreate},
+		{"GET /api/webhooks", apiCfg.handlerWebhookEndpointsGet},
+		{"DELETE /api/webhooks/{endpointID}", apiCfg.handlerWebhookEndpointDelete},
+		{"GET /api/webhooks/{endpointID}/deliveries", apiCfg.handlerWebhookDeliveriesGet},
+		{"POST /api/webhooks/{endpointID}/ping", apiCfg.handlerWebhookEndpointPing},
+		{"GET /api/timeline", apiCfg.handlerTimelineGet},
+		{"GET /admin/filter/terms", apiCfg.handlerFilterTermsGet},
+		{"POST /admin/filter/terms", apiCfg.handlerFilterTermsCreate},
+		{"DELETE /admin/filter/terms/{term}", apiCfg.handlerFilterTermsDelete},
+		{"GET /admin/lockouts", apiCfg.handlerLockoutsGet},
+		{"DELETE /admin/lockouts/{scope}/{key}", apiCfg.handlerLockoutDelete},
+		{"GET /admin/moderation", apiCfg.handlerModerationFlagsGet},
+		{"POST /admin/moderation/{flagID}/resolve", apiCfg.handlerModerationFlagResolve},
+		{"GET /admin/webhooks", apiCfg.handlerWebhookEventsGet},
+		{"GET /admin/webhooks/{eventID}", apiCfg.handlerWebhookEventGet},
+		{"POST /admin/webhooks/{eventID}/replay", apiCfg.handlerWebhookEventReplay},
+	}
+	var routesOff []string
+	for _, route := range postgresRoutes {
+		if apiCfg.db == nil {
+			routesOff = append(routesOff, route.pattern)
+			continue
+		}
+		mux.HandleFunc(route.pattern, route.handler)
+	}
+	if len(routesOff) > 0 {
+		slog.Warn("Routes that need Postgres are off", "routes", routesOff)
+	}
+
+	policies, err := apiCfg.rateLimitPolicies(conf.RateLimits)
+	if err != nil {
+		log.Fatalf("Error parsing rate limits: %s", err)
+	}
+	limiter := &ratelimit.Middleware{
+		Policies: policies,
+		Pattern: func(r *http.Request) string {
+			_, pattern := mux.Handler(r)
+			return pattern
+		},
+		OnLimited: apiCfg.respondRateLimited,
+	}
+	switch conf.RateLimitStore {
+	case "memory":
+		limiter.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		pgStore := ratelimit.NewPostgresStore(dbQueries)
+		go pgStore.Prune(ctx, 24*time.Hour)
+		limiter.Store = pgStore
+	}
+
+	ips, err := clientip.NewResolver(conf.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Error parsing trusted proxies: %s", err)
+	}
+
+	accessLog := &logging.Middleware{
+		Logger: logger,
+		UserID: apiCfg.logUserID,
+	}
 
 	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + conf.Port,
+		Handler:           ips.Middleware(accessLog.Handler(metrics.InstrumentHandler(registry, limiter.Handler(mux)))),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Serving", "port", conf.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server error: %s", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting
+	stop()
+
+	apiCfg.shutdown(srv, conf.ShutdownDrain, conf.ShutdownTimeout)
+	if dbConn != nil {
+		if err := dbConn.Close(); err != nil {
+			slog.Error("Error closing database", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// logUserID names the user behind a request in the access log.
+func (cfg *apiConfig) logUserID(r *http.Request) string {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return ""
+	}
+	userID, err := cfg.keys.ValidateJWT(token)
+	if err != nil {
+		return ""
+	}
+	return userID.String()
+}
+
+// defaultProfanityTerms are the terms migration 012 seeds, for when there
+// is no database to load them from.
+var defaultProfanityTerms = []filter.Term{
+	{Word: "kerfuffle", Policy: filter.PolicyMask},
+	{Word: "sharbert", Policy: filter.PolicyMask},
+	{Word: "fornax", Policy: filter.PolicyMask},
+}
+
+// filterReloadInterval is how often the profanity terms are re-read, so
+// changes made through another instance's admin API reach every instance.
+const filterReloadInterval = time.Minute
+
+// loadFilter builds the profanity filter from the profanity_terms table,
+// with terms from an optional word list file layered on top. Without a
+// database the default terms are used instead of the table.
+func loadFilter(db *database.Queries, path string) (*filter.Filter, error) {
+	terms, err := filterTerms(context.Background(), db, path)
+	if err != nil {
+		return nil, err
+	}
+	return filter.New(terms), nil
+}
+
+func filterTerms(ctx context.Context, db *database.Queries, path string) ([]filter.Term, error) {
+	terms := defaultProfanityTerms
+	if db != nil {
+		terms = nil
+		rows, err := db.ListProfanityTerms(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			policy, err := filter.ParsePolicy(row.Policy)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, filter.Term{Word: row.Term, Policy: policy})
+		}
 	}
 
-	log.Printf("Serving on port: %s\n", port)
-	log.Fatal(srv.ListenAndServe())
+	if path != "" {
+		fileTerms, err := filter.LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, fileTerms...)
+	}
+	return terms, nil
+}
+
+// reloadFilter re-reads the terms into f until ctx is done. Errors are
+// logged and the previous terms stay in use.
+func reloadFilter(ctx context.Context, f *filter.Filter, db *database.Queries, path string) {
+	ticker := time.NewTicker(filterReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		terms, err := filterTerms(ctx, db, path)
+		if err != nil {
+			slog.Error("Couldn't reload profanity terms", "error", err)
+			continue
+		}
+		f.Replace(terms)
+	}
+}
+
+// newMailer picks the mail backend from MAILER: smtp, file or log (the
+// default, for development).
+func newMailer(conf *config.Config) (mail.Mailer, error) {
+	switch conf.Mailer {
+	case "file":
+		if conf.MailDir == "" {
+			return nil, fmt.Errorf("MAIL_DIR must be set when MAILER=file")
+		}
+		return &mail.FileMailer{Dir: conf.MailDir, From: conf.MailFrom}, nil
+	case "smtp":
+		if conf.SMTPAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR must be set when MAILER=smtp")
+		}
+		return &mail.SMTPMailer{
+			Addr:     conf.SMTPAddr,
+			From:     conf.MailFrom,
+			Username: conf.SMTPUsername,
+			Password: conf.SMTPPassword,
+		}, nil
+	default:
+		return &mail.LogMailer{}, nil
+	}
 }
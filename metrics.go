@@ -3,8 +3,37 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
 )
 
+// appMetrics are the business counters exposed on /metrics next to the
+// HTTP and database metrics.
+type appMetrics struct {
+	registry       *metrics.Registry
+	fileserverHits *metrics.CounterVec
+	chirpsCreated  *metrics.Counter
+	logins         *metrics.CounterVec
+	webhookEvents  *metrics.CounterVec
+	deliveries     *metrics.CounterVec
+}
+
+func newAppMetrics(reg *metrics.Registry) *appMetrics {
+	return &appMetrics{
+		registry: reg,
+		fileserverHits: reg.NewCounterVec("chirpy_fileserver_hits_total",
+			"Requests to the static file server under /app/."),
+		chirpsCreated: reg.NewCounter("chirpy_chirps_created_total",
+			"Chirps posted, including replies."),
+		logins: reg.NewCounterVec("chirpy_logins_total",
+			"Login attempts by result: success, failure or locked.", "result"),
+		webhookEvents: reg.NewCounterVec("chirpy_webhook_events_total",
+			"Incoming webhook events by source, event type and result.", "source", "event", "result"),
+		deliveries: reg.NewCounterVec("chirpy_webhook_deliveries_total",
+			"Outgoing webhook delivery attempts by event type and result: delivered, failed or dead.", "event", "result"),
+	}
+}
+
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -17,12 +46,12 @@ func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 </body>
 
 </html>
-	`, cfg.fileserverHits.Load())))
+	`, int(cfg.metrics.fileserverHits.With().Value()))))
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
+		cfg.metrics.fileserverHits.With().Inc()
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/logging"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
+)
+
+// Events users can subscribe their webhook endpoints to. An endpoint only
+// hears about its owner's activity.
+const (
+	eventChirpCreated  = "chirp.created"
+	eventChirpDeleted  = "chirp.deleted"
+	eventUserUpgraded  = "user.upgraded"
+	eventFollowCreated = "follow.created"
+
+	// eventPing is only sent on request, to test an endpoint
+	eventPing = "ping"
+)
+
+var webhookEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventUserUpgraded, eventFollowCreated}
+
+// Delivery states, following the inbox: failed deliveries are retried with
+// backoff until they are dead.
+const (
+	deliveryPending    = "pending"
+	deliveryProcessing = "processing"
+	deliveryDelivered  = "delivered"
+	deliveryFailed     = "failed"
+	deliveryDead       = "dead"
+)
+
+const (
+	webhookSignatureHeader = "Chirpy-Signature"
+	webhookEventHeader     = "Chirpy-Event"
+	webhookDeliveryHeader  = "Chirpy-Delivery"
+)
+
+// outboundEvent is the body of every delivery.
+type outboundEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// webhookDispatcher queues events for the endpoints subscribed to them and
+// delivers them in the background. Each delivery is signed with the
+// endpoint's secret in the same format Polka uses for ours.
+type webhookDispatcher struct {
+	db         *database.Queries
+	client     *http.Client
+	deliveries *metrics.CounterVec
+	queue      *workQueue[database.ClaimWebhookDeliveriesRow]
+}
+
+// newWebhookDispatcher creates a dispatcher whose requests time out after
+// timeout. Unless allowPrivate is set, endpoints on loopback and private
+// addresses are refused so users can't point deliveries at our own network.
+func newWebhookDispatcher(db *database.Queries, deliveries *metrics.CounterVec, timeout time.Duration, allowPrivate bool) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	d := &webhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			// A redirect counts as a failed delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		deliveries: deliveries,
+	}
+	d.queue = newWorkQueue("webhook deliveries",
+		func(ctx context.Context, lockedUntil time.Time, limit int32) ([]database.ClaimWebhookDeliveriesRow, error) {
+			return db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+				LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true},
+				BatchSize:   limit,
+			})
+		},
+		d.deliver, db.DeleteOldWebhookDeliveries)
+	return d
+}
+
+// refusePrivateAddress runs after DNS resolution, so it also catches public
+// names that resolve to internal addresses.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+// emit queues an event for the endpoints of the given users that subscribe
+// to it. The action the event describes has already happened, so failures
+// are logged rather than returned. A nil dispatcher drops the event.
+func (d *webhookDispatcher) emit(ctx context.Context, eventType string, data any, userIDs ...uuid.UUID) {
+	if d == nil {
+		return
+	}
+	event := outboundEvent{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logging.FromContext(ctx).Error("Couldn't encode webhook event", "event_type", eventType, "error", err)
+		return
+	}
+
+	queued := int64(0)
+	for _, userID := range userIDs {
+		n, err := d.db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+			EventID:   event.ID,
+			EventType: eventType,
+			Payload:   payload,
+			UserID:    userID,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("Couldn't queue webhook deliveries", "event_type", eventType, "error", err)
+			continue
+		}
+		queued += n
+	}
+	if queued > 0 {
+		d.notify()
+	}
+}
+
+// ping queues a test event for one endpoint, whatever it subscribes to.
+func (d *webhookDispatcher) ping(ctx context.Context, endpointID uuid.UUID) (database.WebhookDelivery, error) {
+	event := outboundEvent{
+		ID:        uuid.New(),
+		Type:      eventPing,
+		CreatedAt: time.Now().UTC(),
+		Data:      map[string]uuid.UUID{"endpoint_id": endpointID},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+
+	delivery, err := d.db.EnqueueWebhookDelivery(ctx, database.EnqueueWebhookDeliveryParams{
+		EndpointID: endpointID,
+		EventID:    event.ID,
+		EventType:  eventPing,
+		Payload:    payload,
+	})
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// notify wakes the worker without waiting for the next poll.
+func (d *webhookDispatcher) notify() { d.queue.notify() }
+
+// run delivers due events until ctx is done.
+func (d *webhookDispatcher) run(ctx context.Context) { d.queue.run(ctx) }
+
+// deliver sends one claimed delivery and records the outcome.
+func (d *webhookDispatcher) deliver(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) {
+	statusCode, err := d.send(ctx, delivery)
+	responseStatus := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+	logger := slog.With("delivery_id", delivery.ID, "endpoint_id", delivery.EndpointID, "event_type", delivery.EventType, "attempt", delivery.Attempts)
+
+	if err == nil {
+		d.deliveries.With(delivery.EventType, deliveryDelivered).Inc()
+		err := d.db.MarkWebhookDeliveryDelivered(ctx, database.MarkWebhookDeliveryDeliveredParams{
+			ID:             delivery.ID,
+			ResponseStatus: responseStatus,
+		})
+		if err != nil {
+			logger.Error("Couldn't mark webhook delivered", "error", err)
+		}
+		return
+	}
+
+	status := deliveryFailed
+	nextAttempt, dead := retryAfter(delivery.Attempts)
+	if dead {
+		status = deliveryDead
+	}
+	d.deliveries.With(delivery.EventType, status).Inc()
+	logger.Warn("Webhook delivery failed", "status", status, "response_status", statusCode, "error", err)
+
+	err = d.db.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		Status:         status,
+		ResponseStatus: responseStatus,
+		LastError:      sql.NullString{String: err.Error(), Valid: true},
+		NextAttemptAt:  nextAttempt,
+		ID:             delivery.ID,
+	})
+	if err != nil {
+		logger.Error("Couldn't mark webhook delivery failed", "error", err)
+	}
+}
+
+// send posts one delivery and returns the response status, if there was a
+// response. Anything but a 2xx is an error.
+func (d *webhookDispatcher) send(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(webhookSignatureHeader, auth.WebhookSignatureHeader([]string{delivery.Secret}, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("endpoint responded with " + strconv.Itoa(resp.StatusCode))
+	}
+	return resp.StatusCode, nil
+}
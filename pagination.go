@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor is the keyset position a page starts after. It is handed to
+// clients as an opaque base64 string. Rank is only set for relevance-ordered
+// search results.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Rank      float64   `json:"r,omitempty"`
+	Prev      bool      `json:"p,omitempty"`
+}
+
+type pageRequest struct {
+	Limit  int
+	Cursor *pageCursor
+}
+
+// backward reports whether the client is paging towards the start of the list.
+func (p pageRequest) backward() bool {
+	return p.Cursor != nil && p.Cursor.Prev
+}
+
+func encodeCursor(c pageCursor) string {
+	dat, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	c := pageCursor{}
+	if err := json.Unmarshal(dat, &c); err != nil {
+		return pageCursor{}, err
+	}
+	if c.ID == uuid.Nil || c.CreatedAt.IsZero() {
+		return pageCursor{}, errors.New("incomplete cursor")
+	}
+	return c, nil
+}
+
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageLimit}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return pageRequest{}, fmt.Errorf("invalid limit %q", limit)
+		}
+		page.Limit = min(n, maxPageLimit)
+	}
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return pageRequest{}, fmt.Errorf("invalid cursor: %w", err)
+		}
+		page.Cursor = &c
+	}
+
+	return page, nil
+}
+
+// paginate trims rows fetched with a limit of page.Limit+1 down to one page,
+// restores display order when paging backwards and works out the cursors for
+// the neighbouring pages.
+func paginate[T any](rows []T, page pageRequest, key func(T) pageCursor) (items []T, next, prev *pageCursor) {
+	hasMore := len(rows) > page.Limit
+	if hasMore {
+		rows = rows[:page.Limit]
+	}
+	if len(rows) == 0 {
+		return rows, nil, nil
+	}
+
+	hasNext, hasPrev := hasMore, page.Cursor != nil
+	if page.backward() {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		c := key(rows[len(rows)-1])
+		next = &c
+	}
+	if hasPrev {
+		c := key(rows[0])
+		c.Prev = true
+		prev = &c
+	}
+	return rows, next, prev
+}
+
+// setPageLinks advertises the neighbouring pages in an RFC 8288 Link header.
+func setPageLinks(w http.ResponseWriter, r *http.Request, next, prev *pageCursor) {
+	links := []string{}
+	for _, l := range []struct {
+		rel    string
+		cursor *pageCursor
+	}{{"next", next}, {"prev", prev}} {
+		if l.cursor == nil {
+			continue
+		}
+		q := r.URL.Query()
+		q.Set("cursor", encodeCursor(*l.cursor))
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), l.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
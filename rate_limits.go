@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/ratelimit"
+)
+
+const rateLimitTierRed = "red"
+
+type routeLimit struct {
+	key   string // user, ip or apikey
+	limit string
+	red   string
+}
+
+// defaultRateLimits are keyed by route pattern as registered on the mux.
+// RATE_LIMITS overrides them, see parseRateLimitOverrides.
+var defaultRateLimits = map[string]routeLimit{
+	"POST /api/users":                 {key: "ip", limit: "10/1h"},
+	"POST /api/login":                 {key: "ip", limit: "30/1m"},
+	"POST /api/login/mfa":             {key: "ip", limit: "30/1m"},
+	"POST /api/password/forgot":       {key: "ip", limit: "5/1h"},
+	"POST /api/password/reset":        {key: "ip", limit: "10/1h"},
+	"POST /api/users/verify/resend":   {key: "user", limit: "5/1h"},
+	"POST /api/chirps":                {key: "user", limit: "30/1m", red: "120/1m"},
+	"PUT /api/chirps/{chirpID}":       {key: "user", limit: "30/1m", red: "120/1m"},
+	"POST /api/chirps/{chirpID}/like": {key: "user", limit: "120/1m", red: "600/1m"},
+	"POST /api/users/{userID}/follow": {key: "user", limit: "60/1m", red: "300/1m"},
+	"GET /api/chirps/search":          {key: "ip", limit: "60/1m"},
+	"POST /api/polka/webhooks":        {key: "apikey", limit: "120/1m"},
+}
+
+// rateLimitPolicies builds the middleware policies from the defaults and
+// the overrides in RATE_LIMITS.
+func (cfg *apiConfig) rateLimitPolicies(overrides string) (map[string]ratelimit.Policy, error) {
+	routes := make(map[string]routeLimit, len(defaultRateLimits))
+	for pattern, rl := range defaultRateLimits {
+		routes[pattern] = rl
+	}
+	if err := parseRateLimitOverrides(overrides, routes); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]ratelimit.Policy, len(routes))
+	for pattern, rl := range routes {
+		limit, err := ratelimit.ParseLimit(rl.limit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		policy := ratelimit.Policy{Limit: limit}
+		if rl.red != "" {
+			red, err := ratelimit.ParseLimit(rl.red)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			}
+			policy.Tiers = map[string]ratelimit.Limit{rateLimitTierRed: red}
+		}
+
+		switch rl.key {
+		case "user":
+			policy.Key = cfg.rateLimitByUser
+		case "ip":
+			policy.Key = ratelimit.ByIP
+		case "apikey":
+			policy.Key = cfg.rateLimitByAPIKey
+		default:
+			return nil, fmt.Errorf("%s: unknown rate limit key %q", pattern, rl.key)
+		}
+		policies[pattern] = policy
+	}
+	return policies, nil
+}
+
+// parseRateLimitOverrides reads entries separated by semicolons, each a
+// route pattern and a limit with an optional Chirpy Red limit, or "off":
+//
+//	POST /api/chirps=60/1m,red=300/1m; POST /api/users=off
+//
+// Routes without a default are keyed by client IP.
+func parseRateLimitOverrides(s string, routes map[string]routeLimit) error {
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("RATE_LIMITS entry %q must look like PATTERN=LIMIT", entry)
+		}
+		pattern = strings.TrimSpace(pattern)
+		if strings.TrimSpace(value) == "off" {
+			delete(routes, pattern)
+			continue
+		}
+
+		rl, ok := routes[pattern]
+		if !ok {
+			rl = routeLimit{key: "ip"}
+		}
+		limit, red, _ := strings.Cut(value, ",")
+		rl.limit = strings.TrimSpace(limit)
+		if red != "" {
+			red, ok = strings.CutPrefix(strings.TrimSpace(red), "red=")
+			if !ok {
+				return fmt.Errorf("RATE_LIMITS entry %q: expected red=LIMIT after the comma", entry)
+			}
+			rl.red = red
+		}
+		routes[pattern] = rl
+	}
+	return nil
+}
+
+// rateLimitByUser keys requests by the user in the access token, with
+// Chirpy Red members on their own tier. Requests without a valid token
+// share their IP's bucket; the handler rejects them anyway.
+func (cfg *apiConfig) rateLimitByUser(r *http.Request) (key, tier string) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return ratelimit.ByIP(r)
+	}
+	userID, err := cfg.keys.ValidateJWT(token)
+	if err != nil {
+		return ratelimit.ByIP(r)
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err == nil && user.IsChirpyRed {
+		tier = rateLimitTierRed
+	}
+	return "user:" + userID.String(), tier
+}
+
+// rateLimitByAPIKey keys requests by the credential they carry, once it
+// checks out: ADMIN_KEY, POLKA_KEY or a valid Polka signature. Anything
+// else shares its IP's bucket, so made-up keys don't get fresh buckets.
+func (cfg *apiConfig) rateLimitByAPIKey(r *http.Request) (key, tier string) {
+	if apiKey, err := auth.GetAPIKey(r.Header); err == nil {
+		switch {
+		case cfg.adminKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) == 1:
+			return "key:admin", ""
+		case cfg.polkaAuth == polkaAuthAPIKey && cfg.polkaKey != "" &&
+			subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) == 1:
+			return "key:polka", ""
+		}
+	}
+
+	if header := r.Header.Get(polkaSignatureHeader); header != "" && cfg.polkaAuth == polkaAuthSignature {
+		// The signature covers the body, so read it and put it back for
+		// the handler
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err == nil {
+			_, err = auth.VerifyWebhookSignature(header, body, cfg.polkaSecrets, cfg.polkaSignatureTolerance, time.Now())
+		}
+		if err == nil {
+			return "key:polka", ""
+		}
+	}
+	return ratelimit.ByIP(r)
+}
+
+func (cfg *apiConfig) respondRateLimited(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, http.StatusTooManyRequests, "Too many requests, try again later", nil)
+}
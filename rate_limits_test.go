@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/auth"
+)
+
+func TestRateLimitByAPIKey(t *testing.T) {
+	cfg := &apiConfig{
+		adminKey:                "admin-key",
+		polkaAuth:               polkaAuthAPIKey,
+		polkaKey:                "polka-key",
+		polkaSecrets:            []string{"whsec"},
+		polkaSignatureTolerance: 5 * time.Minute,
+	}
+
+	tests := []struct {
+		name      string
+		polkaAuth string
+		header    string
+		value     string
+		want      string
+	}{
+		{"admin key", polkaAuthAPIKey, "Authorization", "ApiKey admin-key", "key:admin"},
+		{"polka key", polkaAuthAPIKey, "Authorization", "ApiKey polka-key", "key:polka"},
+		{"unknown key", polkaAuthAPIKey, "Authorization", "ApiKey made-up", "ip:192.0.2.1"},
+		{"polka key in signature mode", polkaAuthSignature, "Authorization", "ApiKey polka-key", "ip:192.0.2.1"},
+		{"valid signature", polkaAuthSignature, polkaSignatureHeader,
+			auth.WebhookSignatureHeader([]string{"whsec"}, time.Now().Unix(), []byte(`{"event":"x"}`)), "key:polka"},
+		{"bad signature", polkaAuthSignature, polkaSignatureHeader,
+			auth.WebhookSignatureHeader([]string{"other"}, time.Now().Unix(), []byte(`{"event":"x"}`)), "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		cfg.polkaAuth = tt.polkaAuth
+		r := httptest.NewRequest("POST", "/api/polka/webhooks", strings.NewReader(`{"event":"x"}`))
+		r.Header.Set(tt.header, tt.value)
+
+		if key, _ := cfg.rateLimitByAPIKey(r); key != tt.want {
+			t.Errorf("%s: expected key %q, got %q", tt.name, tt.want, key)
+		}
+		if body, _ := io.ReadAll(r.Body); string(body) != `{"event":"x"}` {
+			t.Errorf("%s: handler would see body %q", tt.name, body)
+		}
+	}
+}
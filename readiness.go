@@ -2,8 +2,14 @@ package main
 
 import "net/http"
 
-func handlerReadiness(w http.ResponseWriter, r *http.Request) {
+// handlerReadiness reports 503 while the server drains before shutdown, so
+// load balancers stop sending new requests.
+func (cfg *apiConfig) handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if cfg.draining.Load() {
+		status = http.StatusServiceUnavailable
+	}
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(http.StatusText(http.StatusOK)))
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
 }
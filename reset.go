@@ -9,8 +9,8 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cfg.fileserverHits.Store(0)
-	err := cfg.db.Reset(r.Context())
+	cfg.metrics.fileserverHits.Reset()
+	err := cfg.store.Reset(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Failed to reset the database: " + err.Error()))
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// shutdown marks the server as draining and waits for load balancers to
+// notice, then stops accepting connections and waits up to timeout for
+// in-flight requests and background jobs such as outgoing emails and the
+// webhook workers.
+func (cfg *apiConfig) shutdown(srv *http.Server, drain, timeout time.Duration) {
+	cfg.draining.Store(true)
+	slog.Info("Shutting down", "drain", drain)
+	time.Sleep(drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cfg.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("Gave up waiting for background jobs", "error", ctx.Err())
+	}
+}
@@ -1,28 +1,177 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+WITH parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count + 1
+    WHERE id = sqlc.narg('in_reply_to')::uuid
+)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
-    $1,
-    $2
+    sqlc.arg('body'),
+    sqlc.arg('user_id'),
+    sqlc.narg('in_reply_to')::uuid
 )
 RETURNING *;
 
--- name: GetAllChirps :many
+-- name: GetChirpByID :one
 SELECT *
 FROM chirps
-ORDER BY created_at ASC;
+WHERE id = $1;
 
--- name: GetChirpByID :one
+-- name: DeleteChirp :one
+-- Only deletes a chirp without replies. A reply being posted locks the row
+-- to bump reply_count, so the check can't miss it.
+WITH deleted AS (
+    DELETE FROM chirps WHERE chirps.id = $1 AND reply_count = 0 RETURNING in_reply_to
+), parent AS (
+    UPDATE chirps
+    SET reply_count = reply_count - 1
+    WHERE id = (SELECT in_reply_to FROM deleted)
+)
+SELECT count(*) FROM deleted;
+
+-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = NOW()
+WHERE id = $1;
+
+-- name: ListChirpsAsc :many
 SELECT *
 FROM chirps
-WHERE id = $1;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
 
--- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1;
+-- name: SearchChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, reply_count, like_count,
+    ts_rank(body_tsv, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank,
+    ts_headline('english',
+        replace(replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'),
+        websearch_to_tsquery('english', sqlc.arg('query')),
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')::text AS snippet
+FROM chirps
+WHERE body_tsv @@ websearch_to_tsquery('english', sqlc.arg('query'))
+  AND deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+  AND (sqlc.narg('cursor_rank')::real IS NULL
+    OR (ts_rank(body_tsv, websearch_to_tsquery('english', sqlc.arg('query'))), id)
+        < (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_id')::uuid))
+ORDER BY rank DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: SearchChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, reply_count, like_count,
+    ts_rank(body_tsv, websearch_to_tsquery('english', sqlc.arg('query')))::real AS rank,
+    ts_headline('english',
+        replace(replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'),
+        websearch_to_tsquery('english', sqlc.arg('query')),
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')::text AS snippet
+FROM chirps
+WHERE body_tsv @@ websearch_to_tsquery('english', sqlc.arg('query'))
+  AND deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+  AND (sqlc.narg('cursor_rank')::real IS NULL
+    OR (ts_rank(body_tsv, websearch_to_tsquery('english', sqlc.arg('query'))), id)
+        > (sqlc.narg('cursor_rank')::real, sqlc.narg('cursor_id')::uuid))
+ORDER BY rank ASC, id ASC
+LIMIT sqlc.arg('row_limit');
 
--- name: GetChirpsByAuthor :many
-SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+-- name: UpdateChirpBody :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, chirps.updated_at, NOW()
+    FROM chirps
+    WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, depth) AS (
+    SELECT c.in_reply_to, 1
+    FROM chirps c
+    WHERE c.id = $1 AND c.in_reply_to IS NOT NULL
+    UNION ALL
+    SELECT c.in_reply_to, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.id
+    WHERE c.in_reply_to IS NOT NULL
+)
+SELECT chirps.*
+FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendantsAsc :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c WHERE c.in_reply_to = sqlc.arg('chirp_id')::uuid
+    UNION ALL
+    SELECT c.id FROM chirps c JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT chirps.*
+FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetChirpDescendantsDesc :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c WHERE c.in_reply_to = sqlc.arg('chirp_id')::uuid
+    UNION ALL
+    SELECT c.id FROM chirps c JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT chirps.*
+FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetTimelineAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+  AND (user_id = sqlc.arg('user_id')::uuid
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')::uuid))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: GetTimelineDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+  AND (user_id = sqlc.arg('user_id')::uuid
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')::uuid))
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
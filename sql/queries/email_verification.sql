@@ -0,0 +1,27 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: DeleteEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens
+WHERE user_id = $1;
+
+-- name: SetUserPendingEmail :exec
+UPDATE users
+SET pending_email = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email = sqlc.arg('email'),
+    email_verified_at = NOW(),
+    pending_email = CASE WHEN pending_email = sqlc.arg('email') THEN NULL ELSE pending_email END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND (email = sqlc.arg('email') OR pending_email = sqlc.arg('email'))
+RETURNING *;
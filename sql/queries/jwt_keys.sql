@@ -0,0 +1,16 @@
+-- name: ListJWTKeys :many
+SELECT *
+FROM jwt_keys
+WHERE expires_at > NOW()
+ORDER BY generation DESC;
+
+-- name: CreateJWTKey :one
+-- Returns no row when another instance already created this generation.
+INSERT INTO jwt_keys (kid, algorithm, private_key, created_at, expires_at, generation)
+VALUES ($1, $2, $3, NOW(), $4, $5)
+ON CONFLICT (generation) DO NOTHING
+RETURNING *;
+
+-- name: DeleteExpiredJWTKeys :execrows
+DELETE FROM jwt_keys
+WHERE expires_at <= NOW();
@@ -0,0 +1,39 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (scope, key, failures, first_failure_at, last_failure_at)
+VALUES (sqlc.arg('scope'), sqlc.arg('key'), 1, NOW(), NOW())
+ON CONFLICT (scope, key) DO UPDATE SET
+    failures = CASE
+        WHEN login_failures.last_failure_at < sqlc.arg('reset_before')::timestamp THEN 1
+        ELSE login_failures.failures + 1
+    END,
+    first_failure_at = CASE
+        WHEN login_failures.last_failure_at < sqlc.arg('reset_before')::timestamp THEN NOW()
+        ELSE login_failures.first_failure_at
+    END,
+    last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET locked_until = NOW() + sqlc.arg('seconds')::int * INTERVAL '1 second'
+WHERE scope = sqlc.arg('scope') AND key = sqlc.arg('key');
+
+-- name: GetLoginRetryAfter :one
+SELECT COALESCE(MAX(CEIL(EXTRACT(EPOCH FROM (locked_until - NOW())))), 0)::int AS retry_after
+FROM login_failures
+WHERE locked_until > NOW()
+  AND ((scope = 'account' AND key = sqlc.arg('account')) OR (scope = 'ip' AND key = sqlc.arg('ip')));
+
+-- name: ListLoginLockouts :many
+SELECT *
+FROM login_failures
+WHERE locked_until > NOW()
+ORDER BY locked_until DESC;
+
+-- name: ClearLoginFailures :execrows
+DELETE FROM login_failures
+WHERE scope = $1 AND key = $2;
+
+-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
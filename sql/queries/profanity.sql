@@ -0,0 +1,30 @@
+-- name: ListProfanityTerms :many
+SELECT *
+FROM profanity_terms
+ORDER BY term;
+
+-- name: UpsertProfanityTerm :one
+INSERT INTO profanity_terms (term, policy, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (term) DO UPDATE SET policy = EXCLUDED.policy
+RETURNING *;
+
+-- name: DeleteProfanityTerm :execrows
+DELETE FROM profanity_terms
+WHERE term = $1;
+
+-- name: CreateModerationFlag :one
+INSERT INTO moderation_flags (id, chirp_id, terms, created_at)
+VALUES (gen_random_uuid(), $1, $2, NOW())
+RETURNING *;
+
+-- name: ListOpenModerationFlags :many
+SELECT *
+FROM moderation_flags
+WHERE resolved_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: ResolveModerationFlag :execrows
+UPDATE moderation_flags
+SET resolved_at = NOW()
+WHERE id = $1 AND resolved_at IS NULL;
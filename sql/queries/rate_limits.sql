@@ -0,0 +1,13 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg('key'), sqlc.arg('burst')::float8 - 1, true, NOW())
+ON CONFLICT (key) DO UPDATE SET
+    tokens = LEAST(sqlc.arg('burst')::float8, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at)) * sqlc.arg('rate')::float8)
+        - CASE WHEN LEAST(sqlc.arg('burst')::float8, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at)) * sqlc.arg('rate')::float8) >= 1 THEN 1 ELSE 0 END,
+    allowed = LEAST(sqlc.arg('burst')::float8, b.tokens + EXTRACT(EPOCH FROM (NOW() - b.updated_at)) * sqlc.arg('rate')::float8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
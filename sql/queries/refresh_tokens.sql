@@ -1,12 +1,16 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, device_label)
 VALUES(
     $1,
     NOW(),
     NOW(),
     $2,
     $3,
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    $7
 )
 RETURNING *;
 
@@ -19,3 +23,42 @@ WHERE token = $1;
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
 WHERE token = $1;
+
+-- name: RotateRefreshToken :one
+-- The successor keeps the family's expiry, so refreshing never extends a
+-- session past its login.
+WITH rotated AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW(), replaced_by = sqlc.arg('new_token')
+    WHERE token = sqlc.arg('old_token') AND revoked_at IS NULL
+    RETURNING user_id, family_id, user_agent, device_label, expires_at
+)
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip_address, device_label)
+SELECT sqlc.arg('new_token'), NOW(), NOW(), rotated.user_id, rotated.expires_at, NULL, rotated.family_id,
+    rotated.user_agent, sqlc.arg('ip_address'), rotated.device_label
+FROM rotated
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListActiveSessions :many
+SELECT rt.family_id, rt.user_agent, rt.ip_address, rt.device_label, rt.expires_at,
+    rt.created_at AS last_used_at,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id)::timestamp AS created_at
+FROM refresh_tokens rt
+WHERE rt.user_id = $1 AND rt.revoked_at IS NULL AND rt.expires_at > NOW()
+ORDER BY rt.created_at DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = sqlc.arg('user_id') AND revoked_at IS NULL
+  AND (sqlc.narg('except_family_id')::uuid IS NULL OR family_id <> sqlc.narg('except_family_id')::uuid);
@@ -0,0 +1,67 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: ApplySubscription :one
+-- Applies a Polka event in one statement, so the row is locked while it is
+-- merged with the event. Events received before the last one applied change
+-- nothing and return no row. was_chirpy_red is the user's status before.
+WITH sub AS (
+    INSERT INTO subscriptions (user_id, created_at, updated_at, status, plan, period_end, last_event_at)
+    VALUES (
+        sqlc.arg('user_id'),
+        NOW(),
+        NOW(),
+        sqlc.arg('status'),
+        COALESCE(sqlc.narg('plan')::text, sqlc.arg('default_plan')::text),
+        sqlc.narg('new_period_end')::timestamp,
+        sqlc.arg('event_at')::timestamp
+    )
+    ON CONFLICT (user_id) DO UPDATE SET
+        updated_at = NOW(),
+        status = EXCLUDED.status,
+        plan = COALESCE(sqlc.narg('plan')::text, subscriptions.plan),
+        period_end = CASE
+            WHEN sqlc.arg('replace_period_end')::boolean THEN sqlc.narg('period_end')::timestamp
+            ELSE COALESCE(
+                sqlc.narg('period_end')::timestamp,
+                subscriptions.period_end,
+                sqlc.narg('period_end_default')::timestamp
+            )
+        END,
+        last_event_at = EXCLUDED.last_event_at
+    WHERE subscriptions.last_event_at IS NULL OR subscriptions.last_event_at <= EXCLUDED.last_event_at
+    RETURNING *,
+        status IN ('active', 'past_due', 'canceled') AND (period_end IS NULL OR period_end > NOW()) AS is_chirpy_red
+), red AS (
+    UPDATE users
+    SET is_chirpy_red = sub.is_chirpy_red, updated_at = NOW()
+    FROM sub
+    WHERE users.id = sub.user_id
+)
+SELECT sub.*, users.is_chirpy_red AS was_chirpy_red
+FROM sub
+JOIN users ON users.id = sub.user_id;
+
+-- name: ExpireSubscriptions :many
+WITH expired AS (
+    UPDATE subscriptions
+    SET status = 'expired', updated_at = NOW()
+    WHERE period_end < NOW() AND status IN ('active', 'past_due', 'canceled')
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = false, updated_at = NOW()
+FROM expired
+WHERE users.id = expired.user_id
+RETURNING users.id;
+
+-- name: RecordSubscriptionEvent :exec
+INSERT INTO subscription_events (id, received_at, user_id, event, status, payload)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4);
+
+-- name: ListSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY received_at DESC
+LIMIT $2;
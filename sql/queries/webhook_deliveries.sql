@@ -0,0 +1,63 @@
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, created_at, next_attempt_at)
+SELECT gen_random_uuid(), id, sqlc.arg('event_id'), sqlc.arg('event_type')::text, sqlc.arg('payload'), 'pending', NOW(), NOW()
+FROM webhook_endpoints
+WHERE user_id = sqlc.arg('user_id') AND sqlc.arg('event_type')::text = ANY (events);
+
+-- name: EnqueueWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, created_at, next_attempt_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, 'pending', NOW(), NOW())
+RETURNING *;
+
+-- name: ClaimWebhookDeliveries :many
+WITH claimed AS (
+    UPDATE webhook_deliveries
+    SET status = 'processing', attempts = attempts + 1, locked_until = sqlc.arg('locked_until')
+    WHERE id IN (
+        SELECT id
+        FROM webhook_deliveries
+        WHERE (status IN ('pending', 'failed') AND next_attempt_at <= NOW())
+           OR (status = 'processing' AND locked_until < NOW())
+        ORDER BY next_attempt_at
+        LIMIT sqlc.arg('batch_size')
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, endpoint_id, event_type, payload, attempts
+)
+SELECT claimed.id, claimed.endpoint_id, claimed.event_type, claimed.payload, claimed.attempts,
+       webhook_endpoints.url, webhook_endpoints.secret
+FROM claimed
+JOIN webhook_endpoints ON webhook_endpoints.id = claimed.endpoint_id;
+
+-- name: MarkWebhookDeliveryDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', response_status = $2, last_error = NULL, delivered_at = NOW(), locked_until = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = sqlc.arg('status'), response_status = sqlc.narg('response_status'), last_error = sqlc.arg('last_error'),
+    next_attempt_at = sqlc.arg('next_attempt_at'), locked_until = NULL
+WHERE id = sqlc.arg('id');
+
+-- name: ListWebhookDeliveriesAsc :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg('endpoint_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListWebhookDeliveriesDesc :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg('endpoint_id')
+  AND (sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: DeleteOldWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries
+WHERE status IN ('delivered', 'dead') AND created_at < $1;
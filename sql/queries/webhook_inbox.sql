@@ -0,0 +1,65 @@
+-- name: InsertWebhookEvent :one
+INSERT INTO webhook_inbox (id, source, event_id, event_type, payload, status, received_at, next_attempt_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, 'pending', NOW(), NOW())
+ON CONFLICT (source, event_id) DO NOTHING
+RETURNING *;
+
+-- name: ClaimWebhookEvents :many
+UPDATE webhook_inbox
+SET status = 'processing', attempts = attempts + 1, locked_until = sqlc.arg('locked_until')
+WHERE id IN (
+    SELECT id
+    FROM webhook_inbox
+    WHERE (status IN ('pending', 'failed') AND next_attempt_at <= NOW())
+       OR (status = 'processing' AND locked_until < NOW())
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg('batch_size')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_inbox
+SET status = 'processed', processed_at = NOW(), last_error = NULL, locked_until = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_inbox
+SET status = sqlc.arg('status'), last_error = sqlc.arg('last_error'),
+    next_attempt_at = sqlc.arg('next_attempt_at'), locked_until = NULL
+WHERE id = sqlc.arg('id');
+
+-- name: GetWebhookEvent :one
+SELECT *
+FROM webhook_inbox
+WHERE id = $1;
+
+-- name: ListWebhookEventsAsc :many
+SELECT *
+FROM webhook_inbox
+WHERE (sqlc.narg('source')::text IS NULL OR source = sqlc.narg('source'))
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+  AND (sqlc.narg('cursor_received_at')::timestamp IS NULL
+    OR (received_at, id) > (sqlc.narg('cursor_received_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY received_at ASC, id ASC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListWebhookEventsDesc :many
+SELECT *
+FROM webhook_inbox
+WHERE (sqlc.narg('source')::text IS NULL OR source = sqlc.narg('source'))
+  AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+  AND (sqlc.narg('cursor_received_at')::timestamp IS NULL
+    OR (received_at, id) < (sqlc.narg('cursor_received_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY received_at DESC, id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ReplayWebhookEvent :one
+UPDATE webhook_inbox
+SET status = 'pending', attempts = 0, last_error = NULL, next_attempt_at = NOW(), locked_until = NULL
+WHERE id = $1 AND status <> 'processing'
+RETURNING *;
+
+-- name: DeleteOldWebhookEvents :execrows
+DELETE FROM webhook_inbox
+WHERE status = 'processed' AND received_at < $1;
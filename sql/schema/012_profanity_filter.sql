@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE profanity_terms (
+    term TEXT PRIMARY KEY,
+    policy TEXT NOT NULL DEFAULT 'mask' CHECK (policy IN ('mask', 'reject', 'moderate')),
+    created_at TIMESTAMP NOT NULL
+);
+INSERT INTO profanity_terms (term, policy, created_at) VALUES
+    ('kerfuffle', 'mask', NOW()),
+    ('sharbert', 'mask', NOW()),
+    ('fornax', 'mask', NOW());
+
+CREATE TABLE moderation_flags (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    terms TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+CREATE INDEX moderation_flags_unresolved_idx ON moderation_flags (created_at) WHERE resolved_at IS NULL;
+
+-- +goose Down
+DROP TABLE moderation_flags;
+DROP TABLE profanity_terms;
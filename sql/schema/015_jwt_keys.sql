@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE jwt_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL CHECK (algorithm IN ('RS256', 'EdDSA')),
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX jwt_keys_expires_at_idx ON jwt_keys (expires_at);
+
+-- +goose Down
+DROP TABLE jwt_keys;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE login_failures (
+    scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    first_failure_at TIMESTAMP NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+CREATE INDEX login_failures_locked_until_idx ON login_failures (locked_until);
+
+-- +goose Down
+DROP TABLE login_failures;
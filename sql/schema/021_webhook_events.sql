@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    source TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source, event_id)
+);
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired', 'refunded')),
+    plan TEXT NOT NULL,
+    period_end TIMESTAMP
+);
+CREATE INDEX subscriptions_period_end_idx ON subscriptions (period_end)
+WHERE status IN ('active', 'past_due', 'canceled');
+
+-- Red members from before subscriptions were tracked keep their status
+-- with no end date.
+INSERT INTO subscriptions (user_id, created_at, updated_at, status, plan, period_end)
+SELECT id, NOW(), NOW(), 'active', 'legacy', NULL
+FROM users
+WHERE is_chirpy_red;
+
+-- Every subscription event received, including ones we don't act on. No
+-- foreign key, so events for unknown users are kept too.
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL,
+    user_id UUID,
+    event TEXT NOT NULL,
+    status TEXT,
+    payload JSONB NOT NULL
+);
+CREATE INDEX subscription_events_user_id_idx ON subscription_events (user_id, received_at);
+
+-- +goose Down
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
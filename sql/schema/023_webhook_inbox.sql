@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE webhook_inbox (
+    id UUID PRIMARY KEY,
+    source TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'processing', 'processed', 'failed', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    received_at TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    processed_at TIMESTAMP,
+    UNIQUE (source, event_id)
+);
+CREATE INDEX webhook_inbox_due_idx ON webhook_inbox (next_attempt_at)
+WHERE status IN ('pending', 'failed', 'processing');
+CREATE INDEX webhook_inbox_received_at_idx ON webhook_inbox (received_at);
+
+-- Keep the IDs of events already handled so redeliveries are still caught
+INSERT INTO webhook_inbox (id, source, event_id, event_type, payload, status, received_at, next_attempt_at, processed_at)
+SELECT gen_random_uuid(), source, event_id, 'unknown', '{}', 'processed', received_at, received_at, received_at
+FROM webhook_events;
+
+DROP TABLE webhook_events;
+
+-- +goose Down
+CREATE TABLE webhook_events (
+    source TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (source, event_id)
+);
+CREATE INDEX webhook_events_received_at_idx ON webhook_events (received_at);
+
+INSERT INTO webhook_events (source, event_id, received_at)
+SELECT source, event_id, received_at
+FROM webhook_inbox;
+
+DROP TABLE webhook_inbox;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Addresses are stored lowercased so the unique index ignores case. This
+-- fails if two accounts differ only in case; merge those by hand first.
+UPDATE users SET email = lower(email), pending_email = lower(pending_email);
+UPDATE email_verification_tokens SET email = lower(email);
+
+-- +goose Down
+-- The original case isn't kept, and lowercase addresses stay valid
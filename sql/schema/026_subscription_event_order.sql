@@ -0,0 +1,8 @@
+-- +goose Up
+-- When the newest Polka event applied to the subscription was received.
+-- The inbox retries events out of order, so older ones are skipped. NULL
+-- for subscriptions from before this was tracked.
+ALTER TABLE subscriptions ADD COLUMN last_event_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN last_event_at;
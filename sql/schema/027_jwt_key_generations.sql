@@ -0,0 +1,13 @@
+-- +goose Up
+-- Each key's place in the rotation. It is unique, so instances that decide
+-- to rotate at the same moment create a single key between them.
+ALTER TABLE jwt_keys ADD COLUMN generation BIGINT;
+UPDATE jwt_keys
+SET generation = ranked.n
+FROM (SELECT kid, row_number() OVER (ORDER BY created_at) AS n FROM jwt_keys) ranked
+WHERE jwt_keys.kid = ranked.kid;
+ALTER TABLE jwt_keys ALTER COLUMN generation SET NOT NULL;
+ALTER TABLE jwt_keys ADD CONSTRAINT jwt_keys_generation_key UNIQUE (generation);
+
+-- +goose Down
+ALTER TABLE jwt_keys DROP COLUMN generation;
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/database"
+	"github.com/rovshanmuradov/HTTP-servers-go/internal/metrics"
+)
+
+// Inbox event states. Failed events are retried with backoff; dead ones
+// wait for an admin to replay them.
+const (
+	webhookPending    = "pending"
+	webhookProcessing = "processing"
+	webhookProcessed  = "processed"
+	webhookFailed     = "failed"
+	webhookDead       = "dead"
+)
+
+// webhookProcessor applies one event from the inbox. It may run more than
+// once for the same event, so it must be safe to repeat.
+type webhookProcessor func(ctx context.Context, event database.WebhookInbox) error
+
+// permanentError marks failures that retrying won't fix. The event goes
+// straight to the dead letters.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// webhookInbox persists incoming webhooks before anything acts on them and
+// processes them in the background, with one processor per source.
+type webhookInbox struct {
+	db         *database.Queries
+	processors map[string]webhookProcessor
+	events     *metrics.CounterVec
+	queue      *workQueue[database.WebhookInbox]
+}
+
+func newWebhookInbox(db *database.Queries, events *metrics.CounterVec) *webhookInbox {
+	in := &webhookInbox{
+		db:         db,
+		processors: map[string]webhookProcessor{},
+		events:     events,
+	}
+	in.queue = newWorkQueue("webhook events",
+		func(ctx context.Context, lockedUntil time.Time, limit int32) ([]database.WebhookInbox, error) {
+			return db.ClaimWebhookEvents(ctx, database.ClaimWebhookEventsParams{
+				LockedUntil: sql.NullTime{Time: lockedUntil, Valid: true},
+				BatchSize:   limit,
+			})
+		},
+		in.process, db.DeleteOldWebhookEvents)
+	return in
+}
+
+// receive stores an event. duplicate is true if the source already sent an
+// event with the same ID.
+func (in *webhookInbox) receive(ctx context.Context, source, eventID, eventType string, payload []byte) (duplicate bool, err error) {
+	_, err = in.db.InsertWebhookEvent(ctx, database.InsertWebhookEventParams{
+		Source:    source,
+		EventID:   eventID,
+		EventType: eventType,
+		Payload:   payload,
+	})
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	in.notify()
+	return false, nil
+}
+
+// notify wakes the worker without waiting for the next poll.
+func (in *webhookInbox) notify() { in.queue.notify() }
+
+// run processes due events until ctx is done.
+func (in *webhookInbox) run(ctx context.Context) { in.queue.run(ctx) }
+
+// process runs one claimed event through its source's processor and
+// records the outcome.
+func (in *webhookInbox) process(ctx context.Context, event database.WebhookInbox) {
+	var err error
+	if processor, ok := in.processors[event.Source]; ok {
+		err = processor(ctx, event)
+	} else {
+		err = permanentError{fmt.Errorf("no processor for source %q", event.Source)}
+	}
+	logger := slog.With("webhook_id", event.ID, "source", event.Source, "event_type", event.EventType, "attempt", event.Attempts)
+
+	if err == nil {
+		if err := in.db.MarkWebhookEventProcessed(ctx, event.ID); err != nil {
+			logger.Error("Couldn't mark webhook event processed", "error", err)
+		}
+		return
+	}
+
+	status := webhookFailed
+	nextAttempt, dead := retryAfter(event.Attempts)
+	var permanent permanentError
+	if errors.As(err, &permanent) || dead {
+		status = webhookDead
+	}
+	in.events.With(event.Source, event.EventType, status).Inc()
+	if status == webhookDead {
+		logger.Error("Webhook event moved to dead letters", "error", err)
+	} else {
+		logger.Warn("Webhook event failed, will retry", "error", err)
+	}
+
+	err = in.db.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{
+		Status:        status,
+		LastError:     sql.NullString{String: err.Error(), Valid: true},
+		NextAttemptAt: nextAttempt,
+		ID:            event.ID,
+	})
+	if err != nil {
+		logger.Error("Couldn't mark webhook event failed", "error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Settings shared by the webhook inbox and outgoing deliveries.
+const (
+	webhookBatchSize      = 10
+	webhookPollInterval   = 10 * time.Second
+	webhookLockDuration   = 2 * time.Minute
+	webhookMaxAttempts    = 8
+	webhookBaseBackoff    = 30 * time.Second
+	webhookMaxBackoff     = time.Hour
+	webhookEventRetention = 30 * 24 * time.Hour
+)
+
+// workQueue is the worker behind a table of jobs that are claimed in
+// batches, locked while they run and retried with backoff. Jobs claimed by
+// a worker that died are picked up again once their lock expires.
+type workQueue[T any] struct {
+	// name describes the jobs in log messages, e.g. "webhook events"
+	name string
+	// claim locks up to limit due jobs until lockedUntil and returns them
+	claim func(ctx context.Context, lockedUntil time.Time, limit int32) ([]T, error)
+	// handle runs one job and records the outcome. It may run more than
+	// once for the same job, so it must be safe to repeat.
+	handle func(ctx context.Context, job T)
+	// prune deletes finished jobs older than before
+	prune func(ctx context.Context, before time.Time) (int64, error)
+	wake  chan struct{}
+}
+
+func newWorkQueue[T any](name string,
+	claim func(context.Context, time.Time, int32) ([]T, error),
+	handle func(context.Context, T),
+	prune func(context.Context, time.Time) (int64, error),
+) *workQueue[T] {
+	return &workQueue[T]{
+		name:   name,
+		claim:  claim,
+		handle: handle,
+		prune:  prune,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// notify wakes the worker without waiting for the next poll.
+func (q *workQueue[T]) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run works through due jobs until ctx is done.
+func (q *workQueue[T]) run(ctx context.Context) {
+	poll := time.NewTicker(webhookPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		q.runDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-poll.C:
+		case <-prune.C:
+			if _, err := q.prune(ctx, time.Now().Add(-webhookEventRetention)); err != nil {
+				slog.Error("Couldn't delete old "+q.name, "error", err)
+			}
+		}
+	}
+}
+
+func (q *workQueue[T]) runDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := q.claim(ctx, time.Now().Add(webhookLockDuration), webhookBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Couldn't claim "+q.name, "error", err)
+			}
+			return
+		}
+		for _, job := range jobs {
+			q.runJob(ctx, job)
+		}
+		if len(jobs) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (q *workQueue[T]) runJob(ctx context.Context, job T) {
+	// Finish the job at hand even if we are shutting down
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookLockDuration)
+	defer cancel()
+	q.handle(ctx, job)
+}
+
+// retryAfter returns when a job that failed on the given attempt runs
+// again, and whether it has run out of attempts instead.
+func retryAfter(attempts int32) (next time.Time, dead bool) {
+	return time.Now().Add(webhookBackoff(attempts)), attempts >= webhookMaxAttempts
+}
+
+// webhookBackoff doubles the wait after every attempt, up to an hour.
+func webhookBackoff(attempts int32) time.Duration {
+	d := webhookBaseBackoff
+	for i := int32(1); i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, webhookMaxBackoff)
+}